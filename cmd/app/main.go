@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"log/slog"
+	_ "time/tzdata" // digest timezones, even where the system has none
 
 	"github.com/muskit/hoyocodes-discord-bot/internal/bot"
 	"github.com/muskit/hoyocodes-discord-bot/internal/db"
@@ -1,12 +1,40 @@
 CREATE DATABASE IF NOT EXISTS guild_cfg;
 USE guild_cfg;
 
+CREATE TABLE `Guilds` (
+  `guild_id` BIGINT UNSIGNED PRIMARY KEY,
+  `joined` DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT 'When the bot was first seen in the guild.',
+  `timezone` VARCHAR(64) DEFAULT 'UTC',
+  `quiet_start` SMALLINT UNSIGNED DEFAULT 0 COMMENT 'Minute of the day quiet hours start at, in timezone.',
+  `quiet_end` SMALLINT UNSIGNED DEFAULT 0 COMMENT 'Minute of the day quiet hours end at; equal to quiet_start for none.',
+  `quiet_livestream_bypass` BOOL DEFAULT TRUE COMMENT 'Whether livestream codes are announced during quiet hours.'
+);
+
 CREATE TABLE `Subscriptions` (
   `channel_id` BIGINT UNSIGNED PRIMARY KEY,
   `guild_id` BIGINT UNSIGNED COMMENT 'For server-wide config checking.',
   `active` BOOL DEFAULT true,
   `announce_additions` BOOL DEFAULT true,
-  `announce_removals` BOOL DEFAULT false
+  `announce_removals` BOOL DEFAULT false,
+  `delivery_mode` ENUM ('channel', 'forum', 'thread') DEFAULT 'channel',
+  `target_id` BIGINT UNSIGNED COMMENT 'Forum channel to post in for forum delivery.',
+  `thread_scope` ENUM ('game', 'patch') DEFAULT 'game' COMMENT 'How often a new thread/post is started.',
+  `format` ENUM ('text', 'embed') DEFAULT 'text',
+  `digest` ENUM ('off', 'daily', 'weekly') DEFAULT 'off' COMMENT 'Batch changes into a digest instead of announcing each.',
+  `digest_minute` SMALLINT UNSIGNED DEFAULT 540 COMMENT 'Minute of the day digests are sent at, in digest_timezone.',
+  `digest_weekday` TINYINT UNSIGNED DEFAULT 1 COMMENT 'Day weekly digests are sent on; 0 is Sunday.',
+  `digest_timezone` VARCHAR(64) DEFAULT 'UTC',
+  `digest_last` DATETIME COMMENT 'When the last digest was due.'
+);
+
+CREATE TABLE `DigestQueue` (
+  `channel_id` BIGINT UNSIGNED,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `code` varchar(50),
+  `description` text,
+  `change_type` ENUM ('added', 'removed', 'flagged'),
+  `queued` DATETIME,
+  PRIMARY KEY (`channel_id`, `game`, `code`, `change_type`)
 );
 
 CREATE TABLE `SubscriptionGames` (
@@ -18,14 +46,32 @@ CREATE TABLE `SubscriptionGames` (
 CREATE TABLE `SubscriptionPingRoles` (
   `channel_id` BIGINT UNSIGNED,
   `role_id` BIGINT UNSIGNED,
-  PRIMARY KEY (`channel_id`, `role_id`)
+  `game` ENUM ('', 'Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero') DEFAULT '' COMMENT 'Empty pings for all games.',
+  PRIMARY KEY (`channel_id`, `role_id`, `game`)
+);
+
+CREATE TABLE `SubscriptionThreads` (
+  `channel_id` BIGINT UNSIGNED,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `scope_key` VARCHAR(32) DEFAULT '' COMMENT 'Patch the thread belongs to; empty for per-game threads.',
+  `thread_id` BIGINT UNSIGNED,
+  PRIMARY KEY (`channel_id`, `game`, `scope_key`)
 );
 
 CREATE TABLE `Tickers` (
   `message_id` BIGINT UNSIGNED PRIMARY KEY,
-  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
   `channel_id` BIGINT UNSIGNED,
-  `guild_id` BIGINT UNSIGNED
+  `guild_id` BIGINT UNSIGNED,
+  `style` ENUM ('embed', 'text', 'table') DEFAULT 'embed',
+  `content_hash` CHAR(64) COMMENT 'Hash of what was last rendered, to skip no-op edits.',
+  `status` ENUM ('ok', 'missing', 'forbidden') DEFAULT 'ok' COMMENT 'Outcome of the last update.',
+  `failures` INT UNSIGNED DEFAULT 0 COMMENT 'Updates failed in a row.'
+);
+
+CREATE TABLE `TickerGames` (
+  `message_id` BIGINT UNSIGNED,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  PRIMARY KEY (`message_id`, `game`)
 );
 
 CREATE INDEX `subscription_guild_index` ON `Subscriptions` (`guild_id`);
@@ -33,3 +79,9 @@ CREATE INDEX `subscription_guild_index` ON `Subscriptions` (`guild_id`);
 ALTER TABLE `SubscriptionGames` ADD FOREIGN KEY (`channel_id`) REFERENCES `Subscriptions` (`channel_id`) ON DELETE CASCADE;
 
 ALTER TABLE `SubscriptionPingRoles` ADD FOREIGN KEY (`channel_id`) REFERENCES `Subscriptions` (`channel_id`) ON DELETE CASCADE;
+
+ALTER TABLE `DigestQueue` ADD FOREIGN KEY (`channel_id`) REFERENCES `Subscriptions` (`channel_id`) ON DELETE CASCADE;
+
+ALTER TABLE `SubscriptionThreads` ADD FOREIGN KEY (`channel_id`) REFERENCES `Subscriptions` (`channel_id`) ON DELETE CASCADE;
+
+ALTER TABLE `TickerGames` ADD FOREIGN KEY (`message_id`) REFERENCES `Tickers` (`message_id`) ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,17 @@
+-- Forum and thread delivery for subscriptions.
+USE guild_cfg;
+
+ALTER TABLE `Subscriptions`
+  ADD COLUMN `delivery_mode` ENUM ('channel', 'forum', 'thread') DEFAULT 'channel',
+  ADD COLUMN `target_id` BIGINT UNSIGNED COMMENT 'Forum channel to post in for forum delivery.',
+  ADD COLUMN `thread_scope` ENUM ('game', 'patch') DEFAULT 'game' COMMENT 'How often a new thread/post is started.';
+
+CREATE TABLE `SubscriptionThreads` (
+  `channel_id` BIGINT UNSIGNED,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `scope_key` VARCHAR(32) DEFAULT '' COMMENT 'Patch the thread belongs to; empty for per-game threads.',
+  `thread_id` BIGINT UNSIGNED,
+  PRIMARY KEY (`channel_id`, `game`, `scope_key`)
+);
+
+ALTER TABLE `SubscriptionThreads` ADD FOREIGN KEY (`channel_id`) REFERENCES `Subscriptions` (`channel_id`) ON DELETE CASCADE;
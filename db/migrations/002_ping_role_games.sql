@@ -0,0 +1,7 @@
+-- Ping roles scoped to a game; existing roles keep pinging for all games.
+USE guild_cfg;
+
+ALTER TABLE `SubscriptionPingRoles`
+  ADD COLUMN `game` ENUM ('', 'Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero') DEFAULT '' COMMENT 'Empty pings for all games.',
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (`channel_id`, `role_id`, `game`);
@@ -0,0 +1,4 @@
+-- Embed notification format.
+USE guild_cfg;
+
+ALTER TABLE `Subscriptions` ADD COLUMN `format` ENUM ('text', 'embed') DEFAULT 'text';
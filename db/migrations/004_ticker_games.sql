@@ -0,0 +1,16 @@
+-- Tickers covering several games. Each existing ticker keeps showing its
+-- one game; a ticker without TickerGames rows shows all games.
+USE guild_cfg;
+
+CREATE TABLE `TickerGames` (
+  `message_id` BIGINT UNSIGNED,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  PRIMARY KEY (`message_id`, `game`)
+);
+
+ALTER TABLE `TickerGames` ADD FOREIGN KEY (`message_id`) REFERENCES `Tickers` (`message_id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+INSERT INTO `TickerGames` (`message_id`, `game`)
+  SELECT `message_id`, `game` FROM `Tickers` WHERE `game` IS NOT NULL;
+
+ALTER TABLE `Tickers` DROP COLUMN `game`;
@@ -0,0 +1,4 @@
+-- Compact text and table ticker styles.
+USE guild_cfg;
+
+ALTER TABLE `Tickers` ADD COLUMN `style` ENUM ('embed', 'text', 'table') DEFAULT 'embed';
@@ -0,0 +1,4 @@
+-- Skip no-op ticker edits. Existing tickers are edited once to record theirs.
+USE guild_cfg;
+
+ALTER TABLE `Tickers` ADD COLUMN `content_hash` CHAR(64) COMMENT 'Hash of what was last rendered, to skip no-op edits.';
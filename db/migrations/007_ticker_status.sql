@@ -0,0 +1,6 @@
+-- Track failing tickers.
+USE guild_cfg;
+
+ALTER TABLE `Tickers`
+  ADD COLUMN `status` ENUM ('ok', 'missing', 'forbidden') DEFAULT 'ok' COMMENT 'Outcome of the last update.',
+  ADD COLUMN `failures` INT UNSIGNED DEFAULT 0 COMMENT 'Updates failed in a row.';
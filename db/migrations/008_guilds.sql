@@ -0,0 +1,8 @@
+-- Guilds the bot is in. Left empty; the bot records its current guilds
+-- on startup without welcoming them.
+USE guild_cfg;
+
+CREATE TABLE `Guilds` (
+  `guild_id` BIGINT UNSIGNED PRIMARY KEY,
+  `joined` DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT 'When the bot was first seen in the guild.'
+);
@@ -0,0 +1,4 @@
+-- Keep removed codes for lookups.
+USE scraper;
+
+ALTER TABLE `Codes` ADD COLUMN `removed` datetime DEFAULT NULL COMMENT 'When the code left the source; NULL while active.';
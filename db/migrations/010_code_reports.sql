@@ -0,0 +1,18 @@
+-- Community-reported codes and their review queue.
+USE scraper;
+
+ALTER TABLE `Codes` ADD COLUMN `source` ENUM ('pockettactics', 'community') DEFAULT 'pockettactics' COMMENT 'Community codes are removed after community_code_lifetime unless the source lists them.';
+
+CREATE TABLE `CodeReports` (
+  `id` INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  `code` varchar(50),
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `description` text,
+  `is_livestream` bool,
+  `reporter_id` BIGINT UNSIGNED,
+  `reported` datetime,
+  `status` ENUM ('pending', 'approved', 'rejected') DEFAULT 'pending',
+  `reviewer_id` BIGINT UNSIGNED
+);
+
+CREATE INDEX `report_reporter_index` ON `CodeReports` (`reporter_id`, `reported`);
@@ -0,0 +1,12 @@
+-- Users reporting codes expired.
+USE scraper;
+
+ALTER TABLE `Codes` ADD COLUMN `flagged` datetime DEFAULT NULL COMMENT 'When enough users reported the code expired; NULL if not.';
+
+CREATE TABLE `ExpiryVotes` (
+  `code` varchar(50),
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `user_id` BIGINT UNSIGNED,
+  `voted` datetime,
+  PRIMARY KEY (`code`, `game`, `user_id`)
+);
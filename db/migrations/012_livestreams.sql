@@ -0,0 +1,13 @@
+-- Scheduled livestreams.
+USE scraper;
+
+CREATE TABLE `Livestreams` (
+  `id` INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `title` varchar(100),
+  `start` datetime,
+  `end` datetime,
+  `announced` bool DEFAULT FALSE COMMENT 'Whether the countdown was posted to subscriptions.',
+  `rounded_up` bool DEFAULT FALSE COMMENT 'Whether the post-stream roundup of its codes was posted.',
+  UNIQUE (`game`, `start`)
+);
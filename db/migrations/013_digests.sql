@@ -0,0 +1,21 @@
+-- Subscription digests and their change queue.
+USE guild_cfg;
+
+ALTER TABLE `Subscriptions`
+  ADD COLUMN `digest` ENUM ('off', 'daily', 'weekly') DEFAULT 'off' COMMENT 'Batch changes into a digest instead of announcing each.',
+  ADD COLUMN `digest_minute` SMALLINT UNSIGNED DEFAULT 540 COMMENT 'Minute of the day digests are sent at, in digest_timezone.',
+  ADD COLUMN `digest_weekday` TINYINT UNSIGNED DEFAULT 1 COMMENT 'Day weekly digests are sent on; 0 is Sunday.',
+  ADD COLUMN `digest_timezone` VARCHAR(64) DEFAULT 'UTC',
+  ADD COLUMN `digest_last` DATETIME COMMENT 'When the last digest was due.';
+
+CREATE TABLE `DigestQueue` (
+  `channel_id` BIGINT UNSIGNED,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `code` varchar(50),
+  `description` text,
+  `change_type` ENUM ('added', 'removed', 'flagged'),
+  `queued` DATETIME,
+  PRIMARY KEY (`channel_id`, `game`, `code`, `change_type`)
+);
+
+ALTER TABLE `DigestQueue` ADD FOREIGN KEY (`channel_id`) REFERENCES `Subscriptions` (`channel_id`) ON DELETE CASCADE;
@@ -0,0 +1,8 @@
+-- Per-guild timezone and quiet hours.
+USE guild_cfg;
+
+ALTER TABLE `Guilds`
+  ADD COLUMN `timezone` VARCHAR(64) DEFAULT 'UTC',
+  ADD COLUMN `quiet_start` SMALLINT UNSIGNED DEFAULT 0 COMMENT 'Minute of the day quiet hours start at, in timezone.',
+  ADD COLUMN `quiet_end` SMALLINT UNSIGNED DEFAULT 0 COMMENT 'Minute of the day quiet hours end at; equal to quiet_start for none.',
+  ADD COLUMN `quiet_livestream_bypass` BOOL DEFAULT TRUE COMMENT 'Whether livestream codes are announced during quiet hours.';
@@ -0,0 +1,6 @@
+-- Keep codes moderators confirmed expired from being restored by the scraper.
+USE scraper;
+
+ALTER TABLE `Codes` ADD COLUMN `removed_by` ENUM ('source', 'moderator') DEFAULT NULL COMMENT 'Codes moderators confirmed expired stay removed while the source lists them.' AFTER `removed`;
+
+UPDATE `Codes` SET `removed_by` = 'source' WHERE `removed` IS NOT NULL;
@@ -7,9 +7,46 @@ CREATE TABLE `Codes` (
   `description` text,
   `added` datetime,
   `is_livestream` bool,
+  `removed` datetime DEFAULT NULL COMMENT 'When the code left the source; NULL while active.',
+  `removed_by` ENUM ('source', 'moderator') DEFAULT NULL COMMENT 'Codes moderators confirmed expired stay removed while the source lists them.',
+  `source` ENUM ('pockettactics', 'community') DEFAULT 'pockettactics' COMMENT 'Community codes are removed after community_code_lifetime unless the source lists them.',
+  `flagged` datetime DEFAULT NULL COMMENT 'When enough users reported the code expired; NULL if not.',
   PRIMARY KEY (`code`, `game`)
 );
 
+CREATE TABLE `CodeReports` (
+  `id` INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  `code` varchar(50),
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `description` text,
+  `is_livestream` bool,
+  `reporter_id` BIGINT UNSIGNED,
+  `reported` datetime,
+  `status` ENUM ('pending', 'approved', 'rejected') DEFAULT 'pending',
+  `reviewer_id` BIGINT UNSIGNED
+);
+
+CREATE TABLE `ExpiryVotes` (
+  `code` varchar(50),
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `user_id` BIGINT UNSIGNED,
+  `voted` datetime,
+  PRIMARY KEY (`code`, `game`, `user_id`)
+);
+
+CREATE INDEX `report_reporter_index` ON `CodeReports` (`reporter_id`, `reported`);
+
+CREATE TABLE `Livestreams` (
+  `id` INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
+  `title` varchar(100),
+  `start` datetime,
+  `end` datetime,
+  `announced` bool DEFAULT FALSE COMMENT 'Whether the countdown was posted to subscriptions.',
+  `rounded_up` bool DEFAULT FALSE COMMENT 'Whether the post-stream roundup of its codes was posted.',
+  UNIQUE (`game`, `start`)
+);
+
 CREATE TABLE `ScrapeStats` (
   `game` ENUM ('Honkai Impact 3rd', 'Genshin Impact', 'Honkai Star Rail', 'Zenless Zone Zero'),
   `updated` datetime,
@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/internal/delivery"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// Users allowed to run /admin; set by the owner_ids env var.
+var ownerIDs = map[string]bool{}
+
+func parseOwnerIDs(val string) {
+	for _, id := range strings.Split(val, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ownerIDs[id] = true
+		}
+	}
+}
+
+func HandleAdmin(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !ownerIDs[interactionAuthor(i.Interaction).ID] {
+		RespondPrivate(s, i, "Only the bot's operators can use this command.")
+		return
+	}
+
+	sub := i.ApplicationCommandData().Options[0]
+	opts := parseArgs(sub.Options)
+	switch sub.Name {
+	case "refresh":
+		handleAdminRefresh(s, i, opts)
+	case "stats":
+		handleAdminStats(s, i)
+	case "broadcast":
+		handleAdminBroadcast(s, i, opts)
+	case "livestream":
+		cmd := sub.Options[0]
+		handleAdminLivestream(s, i, cmd.Name, parseArgs(cmd.Options))
+	case "pause":
+		paused := opts["paused"].BoolValue()
+		notificationsPaused.Store(paused)
+		slog.Info(fmt.Sprintf("%v set notifications paused to %v", interactionAuthor(i.Interaction), paused))
+		if paused {
+			RespondPrivate(s, i, "Notifications paused. Codes found meanwhile won't be announced; tickers keep updating. This resets when the bot restarts.")
+		} else {
+			RespondPrivate(s, i, "Notifications resumed.")
+		}
+	}
+}
+
+func handleAdminRefresh(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	games := []string{}
+	if val, exists := opts["game"]; exists {
+		games = append(games, val.StringValue())
+	}
+
+	// a full cycle can take longer than an interaction allows, and waits
+	// for any running one to finish first
+	DeferPrivate(s, i)
+	changes := runUpdate(context.Background(), s, games)
+	out := "**Refresh finished**\n"
+	if len(changes) == 0 {
+		out += "No code changes found."
+	}
+	for game, chg := range changes {
+		out += fmt.Sprintf("- %v: %v added, %v removed\n", game, len(chg.Added), len(chg.Removed))
+	}
+	if notificationsPaused.Load() {
+		out += "\n-# Notifications are paused, so changes weren't announced."
+	}
+	EditResponse(s, i, strings.Trim(out, " \t\n"))
+}
+
+func handleAdminStats(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guilds, err := db.CountGuilds()
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error counting guilds: %v", err))
+		return
+	}
+	subs, err := db.GetSubscriptions()
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error getting subscriptions: %v", err))
+		return
+	}
+	tickers, err := db.GetTickers()
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error getting tickers: %v", err))
+		return
+	}
+	tickerStatuses := map[db.TickerStatus]int{}
+	for _, t := range tickers {
+		tickerStatuses[t.Status]++
+	}
+
+	out := "**Bot stats**\n"
+	out += fmt.Sprintf("**Guilds:** %v\n", guilds)
+	out += fmt.Sprintf("**Subscriptions:** %v\n", len(subs))
+	out += fmt.Sprintf("**Tickers:** %v (%v ok, %v missing, %v forbidden)\n",
+		len(tickers), tickerStatuses[db.TickerOK], tickerStatuses[db.TickerMissing], tickerStatuses[db.TickerForbidden])
+	out += fmt.Sprintf("**Notifications paused:** %v\n", notificationsPaused.Load())
+	out += "**Scrapes:**\n"
+	for _, game := range consts.Games {
+		checked, updated, err := db.GetScrapeTimes(game)
+		if err != nil {
+			out += fmt.Sprintf("- %v: never scraped\n", game)
+			continue
+		}
+		active := len(db.GetCodes(game, db.All, false)) + len(db.GetCodes(game, db.All, true))
+		out += fmt.Sprintf("- %v: %v active codes; checked <t:%v:R>, next <t:%v:R>, source updated <t:%v:R>\n",
+			game, active, checked.Unix(), scrapeSchedule.Next(game).Unix(), updated.Unix())
+	}
+	RespondPrivate(s, i, strings.Trim(out, " \t\n"))
+}
+
+func handleAdminBroadcast(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	msg := &discordgo.MessageSend{Content: opts["message"].StringValue()}
+
+	subs, err := db.GetSubscriptions()
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error getting subscriptions: %v", err))
+		return
+	}
+
+	DeferPrivate(s, i)
+	jobs := []delivery.Job{}
+	for _, sub := range subs {
+		// to the subscribed channel itself, whatever the delivery mode
+		n := &notification{sub: sub, msgs: []*discordgo.MessageSend{msg}}
+		jobs = append(jobs, delivery.Job{
+			Route: sub.ChannelID,
+			Do: func(opts ...discordgo.RequestOption) error {
+				return n.send(s, sub.ChannelID, opts...)
+			},
+			Done: func(err error) {
+				if err != nil {
+					slog.Warn(fmt.Sprintf("Could not broadcast to %v: %v", sub.ChannelID, err))
+				}
+			},
+		})
+	}
+	stats := delivery.Run(context.Background(), deliveryConcurrency, consts.DeliveryMaxRetries, jobs)
+	slog.Info(fmt.Sprintf("Broadcast delivery: %v", stats))
+	EditResponse(s, i, fmt.Sprintf("Broadcast to %v subscriptions: %v", len(subs), stats))
+}
+
+// cmd: add, list or remove
+func handleAdminLivestream(s *discordgo.Session, i *discordgo.InteractionCreate, cmd string, opts CmdOptMap) {
+	switch cmd {
+	case "add":
+		l := db.Livestream{Game: opts["game"].StringValue()}
+		var err error
+		if l.Start, err = util.ParseTime(opts["start"].StringValue()); err != nil {
+			RespondPrivate(s, i, err.Error())
+			return
+		}
+		duration := consts.DefaultLivestreamDuration
+		if val, exists := opts["duration"]; exists {
+			if duration, err = time.ParseDuration(val.StringValue()); err != nil || duration <= 0 {
+				RespondPrivate(s, i, fmt.Sprintf("%q isn't a duration; use eg. 90m or 2h.", val.StringValue()))
+				return
+			}
+		}
+		l.End = l.Start.Add(duration)
+		if val, exists := opts["title"]; exists {
+			l.Title = val.StringValue()
+		}
+		if l.End.Before(time.Now()) {
+			RespondPrivate(s, i, "That livestream is already over.")
+			return
+		}
+
+		added, err := db.AddLivestream(l)
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Error adding livestream: %v", err))
+			return
+		}
+		if !added {
+			RespondPrivate(s, i, fmt.Sprintf("%v already has a livestream starting <t:%v:F>.", l.Game, l.Start.Unix()))
+			return
+		}
+		if err = syncLivestreams(); err != nil {
+			slog.Error(fmt.Sprintf("Error rescheduling for livestreams: %v", err))
+		}
+		RespondPrivate(s, i, fmt.Sprintf(
+			"Scheduled **%v** <t:%v:F> to <t:%v:t>. Subscribers get a countdown %v before it, and a roundup of its codes %v after.",
+			livestreamTitle(l), l.Start.Unix(), l.End.Unix(),
+			util.FormatInterval(consts.LivestreamAnnounceLead), util.FormatInterval(consts.LivestreamPollTail)))
+	case "list":
+		streams, err := db.GetLivestreams(time.Now().Add(-consts.LivestreamPollTail))
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Error getting livestreams: %v", err))
+			return
+		}
+		if len(streams) == 0 {
+			RespondPrivate(s, i, "No livestreams are scheduled.")
+			return
+		}
+		out := "**Livestreams**\n"
+		for _, l := range streams {
+			out += fmt.Sprintf("- `%v` %v: **%v** <t:%v:F> (<t:%v:R>)", l.ID, l.Game, livestreamTitle(l), l.Start.Unix(), l.Start.Unix())
+			if l.Announced {
+				out += " - announced"
+			}
+			out += "\n"
+		}
+		RespondPrivate(s, i, strings.Trim(out, " \t\n"))
+	case "remove":
+		removed, err := db.RemoveLivestream(opts["id"].IntValue())
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Error removing livestream: %v", err))
+			return
+		}
+		if !removed {
+			RespondPrivate(s, i, "There's no livestream with that ID.")
+			return
+		}
+		if err = syncLivestreams(); err != nil {
+			slog.Error(fmt.Sprintf("Error rescheduling for livestreams: %v", err))
+		}
+		RespondPrivate(s, i, "Livestream removed.")
+	}
+}
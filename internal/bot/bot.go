@@ -1,16 +1,22 @@
 package bot
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/joho/godotenv"
 	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
 )
 
 // <@%s> = user
@@ -66,37 +72,92 @@ var (
 		},
 	}
 
-	optionalGameChoices = []*discordgo.ApplicationCommandOption {
+	deliveryChoices = []*discordgo.ApplicationCommandOptionChoice {
 		{
-			Name: "game_1",
-			Description: "A game to check codes for.",
-			Type: discordgo.ApplicationCommandOptionString,
-			Choices: GameChoices,
-			Required: false,
+			Name: "channel",
+			Value: string(db.DeliverChannel),
 		},
 		{
-			Name: "game_2",
-			Description: "A game to check codes for.",
-			Type: discordgo.ApplicationCommandOptionString,
-			Choices: GameChoices,
-			Required: false,
+			Name: "forum",
+			Value: string(db.DeliverForum),
 		},
 		{
-			Name: "game_3",
-			Description: "A game to check codes for.",
-			Type: discordgo.ApplicationCommandOptionString,
-			Choices: GameChoices,
-			Required: false,
+			Name: "thread",
+			Value: string(db.DeliverThread),
+		},
+	}
+
+	formatChoices = []*discordgo.ApplicationCommandOptionChoice {
+		{
+			Name: "text",
+			Value: string(db.FormatText),
+		},
+		{
+			Name: "embed (with redeem buttons)",
+			Value: string(db.FormatEmbed),
+		},
+	}
+
+	threadScopeChoices = []*discordgo.ApplicationCommandOptionChoice {
+		{
+			Name: "game",
+			Value: string(db.ThreadPerGame),
+		},
+		{
+			Name: "patch",
+			Value: string(db.ThreadPerPatch),
+		},
+	}
+
+	digestChoices = []*discordgo.ApplicationCommandOptionChoice {
+		{
+			Name: "off (announce each change)",
+			Value: string(db.DigestOff),
+		},
+		{
+			Name: "daily",
+			Value: string(db.DigestDaily),
 		},
 		{
-			Name: "game_4",
-			Description: "A game to check codes for.",
-			Type: discordgo.ApplicationCommandOptionString,
-			Choices: GameChoices,
-			Required: false,
+			Name: "weekly",
+			Value: string(db.DigestWeekly),
 		},
 	}
 
+	weekdayChoices = []*discordgo.ApplicationCommandOptionChoice {
+		{Name: "Monday", Value: int(time.Monday)},
+		{Name: "Tuesday", Value: int(time.Tuesday)},
+		{Name: "Wednesday", Value: int(time.Wednesday)},
+		{Name: "Thursday", Value: int(time.Thursday)},
+		{Name: "Friday", Value: int(time.Friday)},
+		{Name: "Saturday", Value: int(time.Saturday)},
+		{Name: "Sunday", Value: int(time.Sunday)},
+	}
+
+	tickerStyleChoices = []*discordgo.ApplicationCommandOptionChoice {
+		{
+			Name: "embed",
+			Value: string(db.StyleEmbed),
+		},
+		{
+			Name: "compact text",
+			Value: string(db.StyleText),
+		},
+		{
+			Name: "table",
+			Value: string(db.StyleTable),
+		},
+	}
+
+	// comma-separated games or aliases, parsed with optionGames
+	gamesOption = &discordgo.ApplicationCommandOption{
+		Name: "games",
+		Description: "Games separated by commas, eg. `gi, hsr`. Leave out for all games.",
+		Type: discordgo.ApplicationCommandOptionString,
+		Autocomplete: true,
+		Required: false,
+	}
+
 	integrations = []discordgo.ApplicationIntegrationType {
 		discordgo.ApplicationIntegrationUserInstall,
 		discordgo.ApplicationIntegrationGuildInstall,
@@ -137,17 +198,105 @@ var (
 					Type: discordgo.ApplicationCommandOptionBoolean,
 					Required: false,
 				},
+				{
+					Name: "delivery",
+					Description: "Where announcements are posted. Default: `channel`",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: deliveryChoices,
+					Required: false,
+				},
+				{
+					Name: "forum",
+					Description: "Forum channel to post in when delivery is `forum`.",
+					Type: discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildForum},
+					Required: false,
+				},
+				{
+					Name: "format",
+					Description: "How announcements look. Default: `text`",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: formatChoices,
+					Required: false,
+				},
+				{
+					Name: "new_thread_per",
+					Description: "How often a new thread or forum post is started. Default: `game`",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: threadScopeChoices,
+					Required: false,
+				},
+			},
+		},
+		{
+			Name: "digest",
+			Description: "Batch this channel's code announcements into a daily or weekly digest.",
+			DefaultMemberPermissions: &adminCmdFlag,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name: "frequency",
+					Description: "How often digests are sent, or off to announce each change.",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: digestChoices,
+					Required: true,
+				},
+				{
+					Name: "time",
+					Description: "Time of day digests are sent, as 24-hour HH:MM. Default: 09:00",
+					Type: discordgo.ApplicationCommandOptionString,
+					Required: false,
+				},
+				{
+					Name: "day",
+					Description: "Day weekly digests are sent on. Default: Monday",
+					Type: discordgo.ApplicationCommandOptionInteger,
+					Choices: weekdayChoices,
+					Required: false,
+				},
+				{
+					Name: "timezone",
+					Description: "Timezone of the time, eg. Europe/Berlin. Default: the server's, from /server_settings",
+					Type: discordgo.ApplicationCommandOptionString,
+					Required: false,
+				},
+			},
+		},
+		{
+			Name: "server_settings",
+			Description: "Show or change this server's timezone and quiet hours for announcements.",
+			DefaultMemberPermissions: &adminCmdFlag,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name: "timezone",
+					Description: "The server's timezone, eg. Asia/Tokyo or America/New_York. Default: UTC",
+					Type: discordgo.ApplicationCommandOptionString,
+					Required: false,
+				},
+				{
+					Name: "quiet_hours",
+					Description: "Hold back announcements in this range, eg. 23:00-07:00, or `off`. Default: off",
+					Type: discordgo.ApplicationCommandOptionString,
+					Required: false,
+				},
+				{
+					Name: "livestream_codes_bypass",
+					Description: "Announce livestream codes, which expire quickly, during quiet hours. Default: true",
+					Type: discordgo.ApplicationCommandOptionBoolean,
+					Required: false,
+				},
 			},
 		},
+		{
+			Name: "setup",
+			Description: "Open a panel to configure this channel's subscription and tickers in one place.",
+			DefaultMemberPermissions: &adminCmdFlag,
+		},
 		{
 			Name: "filter_games",
 			Description: "Set games this channel should be subscribed to. Not specifying games will subscribe to all.",
 			DefaultMemberPermissions: &adminCmdFlag,
 			Options: []*discordgo.ApplicationCommandOption{
-				optionalGameChoices[0],
-				optionalGameChoices[1],
-				optionalGameChoices[2],
-				optionalGameChoices[3],
+				gamesOption,
 			},
 		},
 		{
@@ -168,6 +317,13 @@ var (
 					Type: discordgo.ApplicationCommandOptionRole,
 					Required: true,
 				},
+				{
+					Name: "game",
+					Description: "Only ping the role for this game's codes. Default: all games",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: GameChoices,
+					Required: false,
+				},
 			},
 		},
 		{
@@ -181,6 +337,13 @@ var (
 					Type: discordgo.ApplicationCommandOptionRole,
 					Required: true,
 				},
+				{
+					Name: "game",
+					Description: "Only stop pinging the role for this game. Default: all games",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: GameChoices,
+					Required: false,
+				},
 			},
 		},
 		{
@@ -195,18 +358,25 @@ var (
 				},
 			},
 		},
+		{
+			Name: "create_role_picker",
+			Description: "Post a message members can use to pick roles that get pinged for a game's codes.",
+			DefaultMemberPermissions: &adminCmdFlag,
+			Options: rolePickerOptions(),
+		},
 		/// TICKERS ///
 		{
 			Name: "create_ticker",
 			Description: "Create an ticker that self-updates with active codes. Shows all games if none are specified.",
 			DefaultMemberPermissions: &adminCmdFlag,
 			Options: []*discordgo.ApplicationCommandOption{
+				gamesOption,
 				{
-					Name: "game",
-					Description: "Game to create ticker for.",
+					Name: "style",
+					Description: "How the ticker lays out codes. Default: `embed`",
 					Type: discordgo.ApplicationCommandOptionString,
-					Choices: GameChoices,
-					Required: true,
+					Choices: tickerStyleChoices,
+					Required: false,
 				},
 			},
 		},
@@ -217,16 +387,84 @@ var (
 			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Name: "message_link",
-					Description: "Link to message.",
+					Description: "Link to the ticker's message, or its ID.",
 					Type: discordgo.ApplicationCommandOptionString,
 					Required: true,
 				},
 			},
 		},
+		{
+			Name: "edit_ticker",
+			Description: "Change the games, style, pin or channel of a ticker. Unset options are left as they are.",
+			DefaultMemberPermissions: &adminCmdFlag,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name: "message_link",
+					Description: "Link to the ticker's message, or its ID.",
+					Type: discordgo.ApplicationCommandOptionString,
+					Required: true,
+				},
+				gamesOption,
+				{
+					Name: "all_games",
+					Description: "Show all games instead of the picked ones.",
+					Type: discordgo.ApplicationCommandOptionBoolean,
+					Required: false,
+				},
+				{
+					Name: "style",
+					Description: "How the ticker lays out codes.",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: tickerStyleChoices,
+					Required: false,
+				},
+				{
+					Name: "pinned",
+					Description: "Whether the ticker is pinned in its channel.",
+					Type: discordgo.ApplicationCommandOptionBoolean,
+					Required: false,
+				},
+				{
+					Name: "channel",
+					Description: "Move the ticker to this channel. It's posted again there and the old message is deleted.",
+					Type: discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+					Required: false,
+				},
+			},
+		},
 		{
 			Name: "check_tickers",
 			Description: "Show all tickers present in the server.",
 		},
+		{
+			Name: "repair_tickers",
+			Description: "Check every ticker in the server, fixing or cleaning up broken ones.",
+			DefaultMemberPermissions: &adminCmdFlag,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name: "repost",
+					Description: "Post tickers whose message was deleted again in the same channel. Default: false",
+					Type: discordgo.ApplicationCommandOptionBoolean,
+					Required: false,
+				},
+			},
+		},
+		{
+			Name: "Delete ticker",
+			Type: discordgo.MessageApplicationCommand,
+			DefaultMemberPermissions: &adminCmdFlag,
+		},
+		{
+			Name: "Refresh ticker",
+			Type: discordgo.MessageApplicationCommand,
+			DefaultMemberPermissions: &adminCmdFlag,
+		},
+		{
+			Name: "Convert to multi-game",
+			Type: discordgo.MessageApplicationCommand,
+			DefaultMemberPermissions: &adminCmdFlag,
+		},
 		/// MISC ///
 		{
 			Name: "active_codes",
@@ -241,6 +479,164 @@ var (
 				},
 			},
 		},
+		{
+			Name: "code",
+			Description: "Privately look up a code, whether it's still active and where to redeem it.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name: "code",
+					Description: "The code to look up.",
+					Type: discordgo.ApplicationCommandOptionString,
+					Autocomplete: true,
+					Required: true,
+				},
+			},
+		},
+		{
+			Name: "report_code",
+			Description: "Report a code that isn't listed yet. Moderators review it before it's announced.",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name: "code",
+					Description: "The code.",
+					Type: discordgo.ApplicationCommandOptionString,
+					MaxLength: 50,
+					Required: true,
+				},
+				{
+					Name: "game",
+					Description: "The game the code is for.",
+					Type: discordgo.ApplicationCommandOptionString,
+					Choices: GameChoices,
+					Required: true,
+				},
+				{
+					Name: "description",
+					Description: "What the code gives, eg. 60 Primogems.",
+					Type: discordgo.ApplicationCommandOptionString,
+					MaxLength: 200,
+					Required: true,
+				},
+				{
+					Name: "livestream",
+					Description: "Whether it's from a livestream. Default: false",
+					Type: discordgo.ApplicationCommandOptionBoolean,
+					Required: false,
+				},
+			},
+		},
+		/// OPERATORS ///
+		{
+			Name: "admin",
+			Description: "Operate the bot. Only usable by its operators.",
+			DefaultMemberPermissions: &adminCmdFlag,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name: "refresh",
+					Description: "Check for code changes now, updating tickers and notifying subscribers.",
+					Type: discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name: "game",
+							Description: "Only check this game. Default: all games",
+							Type: discordgo.ApplicationCommandOptionString,
+							Choices: GameChoices,
+							Required: false,
+						},
+					},
+				},
+				{
+					Name: "stats",
+					Description: "Show guild, subscription and ticker counts and the last scrapes.",
+					Type: discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name: "broadcast",
+					Description: "Send a notice, eg. about maintenance, to every subscribed channel.",
+					Type: discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name: "message",
+							Description: "The notice to send.",
+							Type: discordgo.ApplicationCommandOptionString,
+							MaxLength: consts.MessageContentLimit,
+							Required: true,
+						},
+					},
+				},
+				{
+					Name: "pause",
+					Description: "Hold back or resume code notifications to subscribers.",
+					Type: discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name: "paused",
+							Description: "Whether notifications are paused.",
+							Type: discordgo.ApplicationCommandOptionBoolean,
+							Required: true,
+						},
+					},
+				},
+				{
+					Name: "livestream",
+					Description: "Manage the livestreams announced to subscribers and polled for codes.",
+					Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name: "add",
+							Description: "Schedule a livestream.",
+							Type: discordgo.ApplicationCommandOptionSubCommand,
+							Options: []*discordgo.ApplicationCommandOption{
+								{
+									Name: "game",
+									Description: "The game streaming.",
+									Type: discordgo.ApplicationCommandOptionString,
+									Choices: GameChoices,
+									Required: true,
+								},
+								{
+									Name: "start",
+									Description: "When it starts, eg. 2026-10-24T12:00:00+08:00 or a Unix timestamp.",
+									Type: discordgo.ApplicationCommandOptionString,
+									Required: true,
+								},
+								{
+									Name: "duration",
+									Description: "How long it runs, eg. 90m. Default: 2h",
+									Type: discordgo.ApplicationCommandOptionString,
+									Required: false,
+								},
+								{
+									Name: "title",
+									Description: "What it's called, eg. \"Version 5.2 Special Program\".",
+									Type: discordgo.ApplicationCommandOptionString,
+									MaxLength: 100,
+									Required: false,
+								},
+							},
+						},
+						{
+							Name: "list",
+							Description: "List upcoming and ongoing livestreams.",
+							Type: discordgo.ApplicationCommandOptionSubCommand,
+						},
+						{
+							Name: "remove",
+							Description: "Unschedule a livestream.",
+							Type: discordgo.ApplicationCommandOptionSubCommand,
+							Options: []*discordgo.ApplicationCommandOption{
+								{
+									Name: "id",
+									Description: "The livestream's ID, from `/admin livestream list`.",
+									Type: discordgo.ApplicationCommandOptionInteger,
+									Required: true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 )
 
@@ -255,6 +651,20 @@ func parseArgs(options []*discordgo.ApplicationCommandInteractionDataOption) (om
 	return
 }
 
+// Games picked in the games option, in consts.Games order.
+func optionGames(opts CmdOptMap) ([]string, error) {
+	val, exists := opts[gamesOption.Name]
+	if !exists {
+		return []string{}, nil
+	}
+
+	games, unknown := util.ParseGameList(val.StringValue())
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("Unknown game(s): %v. Pick from %v.", strings.Join(unknown, ", "), strings.Join(consts.Games, ", "))
+	}
+	return games, nil
+}
+
 func interactionAuthor(i *discordgo.Interaction) *discordgo.User {
 	if i.Member != nil {
 		return i.Member.User
@@ -262,28 +672,68 @@ func interactionAuthor(i *discordgo.Interaction) *discordgo.User {
 	return i.User
 }
 
+// Responses too long for one message are sent as several.
 func Respond(s *discordgo.Session, i *discordgo.InteractionCreate, str string) {
+	pages := util.Paginate(str, consts.MessageContentLimit)
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: str,
+			Content: pages[0],
 		},
 	})
 	if err != nil {
 		log.Panicf("could not respond to interaction: %s", err)
 	}
+	for _, page := range pages[1:] {
+		if _, err = s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{Content: page}); err != nil {
+			log.Panicf("could not send follow-up to interaction: %s", err)
+		}
+	}
 }
 
+// Responses too long for one message get buttons to flip between pages.
 func RespondPrivate(s *discordgo.Session, i *discordgo.InteractionCreate, str string) {
+	var err error
+	if pages := util.Paginate(str, consts.MessageContentLimit); len(pages) > 1 {
+		err = respondPrivatePages(s, i, pages)
+	} else {
+		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: str,
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		})
+	}
+	if err != nil {
+		log.Panicf("could not respond to interaction: %s", err)
+	}
+}
+
+// Acknowledge a command that takes a while; answer it later with EditResponse.
+func DeferPrivate(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: str,
 			Flags: discordgo.MessageFlagsEphemeral,
 		},
 	})
 	if err != nil {
-		log.Panicf("could not respond to interaction: %s", err)
+		log.Panicf("could not defer interaction response: %s", err)
+	}
+}
+
+// Answer a deferred command. Long responses get page buttons like RespondPrivate.
+func EditResponse(s *discordgo.Session, i *discordgo.InteractionCreate, str string) {
+	pages := util.Paginate(str, consts.MessageContentLimit)
+	edit := &discordgo.WebhookEdit{Content: &pages[0]}
+	if len(pages) > 1 {
+		storePages(i.ID, pages)
+		buttons := pageButtons(i.ID, 0, len(pages))
+		edit.Components = &buttons
+	}
+	if _, err := s.InteractionResponseEdit(i.Interaction, edit); err != nil {
+		log.Panicf("could not edit interaction response: %s", err)
 	}
 }
 
@@ -297,6 +747,140 @@ func handleHelp(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOp
 	RespondPrivate(s, i, helpTexts[page])
 }
 
+func handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	// "cast" InteractionData to ApplicationCommandInteractionData
+	data := i.ApplicationCommandData()
+	opts := parseArgs(data.Options)
+
+	slog.Debug(fmt.Sprintf("%s ran %s\n", interactionAuthor(i.Interaction), data.Name))
+	if len(opts) > 0 {
+		slog.Debug("Command options:")
+		for name, val := range opts {
+			slog.Debug(fmt.Sprintf("%s=%v\n", name, val))
+		}
+	}
+
+	// Command matching
+	switch data.Name {
+	case "help":
+		handleHelp(s, i, opts)
+	case "setup":
+		HandleSetup(s, i)
+	case "subscribe":
+		HandleSubscribe(s, i, opts)
+	case "unsubscribe":
+		HandleUnsubscribe(s, i, opts)
+	case "filter_games":
+		HandleFilterGames(s, i, opts)
+	case "check_subscription":
+		HandleCheckSubscription(s, i, opts)
+	case "add_ping_role":
+		HandleAddPingRole(s, i, opts)
+	case "remove_ping_role":
+		HandleRemovePingRole(s, i, opts)
+	case "create_role_picker":
+		HandleCreateRolePicker(s, i, opts)
+	case "create_ticker":
+		HandleCreateTicker(s, i, opts)
+	case "delete_ticker", "Delete ticker":
+		HandleDeleteTicker(s, i, opts)
+	case "code":
+		HandleCode(s, i, opts)
+	case "report_code":
+		HandleReportCode(s, i, opts)
+	case "digest":
+		HandleDigest(s, i, opts)
+	case "server_settings":
+		HandleServerSettings(s, i, opts)
+	case "admin":
+		HandleAdmin(s, i)
+	case "active_codes":
+		HandleActiveCodes(s, i, opts)
+	case "edit_ticker":
+		HandleEditTicker(s, i, opts)
+	case "Refresh ticker":
+		HandleRefreshTicker(s, i, opts)
+	case "Convert to multi-game":
+		HandleConvertTickerMultiGame(s, i, opts)
+	case "check_tickers":
+		HandleGetTickers(s, i)
+	case "repair_tickers":
+		HandleRepairTickers(s, i, opts)
+	default:
+		slog.Warn(fmt.Sprintf("Tried to run an unimplemented command %s!!", data.Name))
+		if len(opts) > 0 {
+			slog.Debug("Command options:")
+			for name, val := range opts {
+				slog.Debug(fmt.Sprintf("%s=%v", name, val))
+			}
+		}
+		RespondPrivate(s, i, "command unimplemented")
+	}
+}
+
+// Suggest choices for the option being typed, by its name.
+func handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	for _, opt := range i.ApplicationCommandData().Options {
+		if opt.Focused {
+			focused = opt
+		}
+	}
+	if focused == nil {
+		return
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	switch focused.Name {
+	case gamesOption.Name:
+		for _, games := range util.CompleteGameList(focused.StringValue()) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: games, Value: games})
+		}
+	case "code":
+		choices = codeChoices(focused.StringValue())
+	default:
+		slog.Warn(fmt.Sprintf("Received autocomplete for unknown option %s!!", focused.Name))
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not respond to autocomplete: %v", err))
+	}
+}
+
+// Component custom IDs are "<handler>:<argument>".
+func handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	name, arg, _ := strings.Cut(data.CustomID, ":")
+
+	slog.Debug(fmt.Sprintf("%s used component %s\n", interactionAuthor(i.Interaction), data.CustomID))
+
+	switch name {
+	case rolePickerPrefix:
+		HandleRolePickerClick(s, i, arg)
+	case pagePrefix:
+		HandlePageClick(s, i, arg)
+	case setupWizardPrefix:
+		HandleSetupWizard(s, i, arg)
+	case setupPanelPrefix:
+		HandleSetupClick(s, i, arg)
+	case codeReportPrefix:
+		HandleCodeReportClick(s, i, arg)
+	case expiryPrefix:
+		HandleExpiryClick(s, i, arg)
+	case expiryVotePrefix:
+		HandleExpiryVote(s, i, arg)
+	case expiryReviewPrefix:
+		HandleExpiryReview(s, i, arg)
+	default:
+		slog.Warn(fmt.Sprintf("Received interaction for unknown component %s!!", data.CustomID))
+		RespondPrivate(s, i, "component unimplemented")
+	}
+}
+
 func RunBot() {
 	slog.Info("Starting bot...")
 	// read env
@@ -308,6 +892,41 @@ func RunBot() {
 	// get vars from env
 	token := os.Getenv("token")
 	appId := os.Getenv("app_id")
+	reviewChannelID = os.Getenv("review_channel_id")
+	parseOwnerIDs(os.Getenv("owner_ids"))
+	if val := os.Getenv("expiry_vote_threshold"); val != "" {
+		if expiryVoteThreshold, err = strconv.Atoi(val); err != nil || expiryVoteThreshold < 1 {
+			log.Fatalf("expiry_vote_threshold must be a positive number, got %q", val)
+		}
+	}
+	if val := os.Getenv("expiry_vote_window"); val != "" {
+		if expiryVoteWindow, err = time.ParseDuration(val); err != nil || expiryVoteWindow <= 0 {
+			log.Fatalf("expiry_vote_window must be a positive duration like 24h, got %q", val)
+		}
+	}
+	if val := os.Getenv("community_code_lifetime"); val != "" {
+		if communityCodeLifetime, err = time.ParseDuration(val); err != nil || communityCodeLifetime <= 0 {
+			log.Fatalf("community_code_lifetime must be a positive duration like 168h, got %q", val)
+		}
+	}
+	if val := os.Getenv("announce_expiry_flags"); val != "" {
+		if announceExpiryFlags, err = strconv.ParseBool(val); err != nil {
+			log.Fatalf("announce_expiry_flags must be true or false, got %q", val)
+		}
+	}
+	if val := os.Getenv("livestream_calendar"); val != "" {
+		if err = seedLivestreams(val); err != nil {
+			log.Fatalf("Could not load livestream calendar %v: %v", val, err)
+		}
+	}
+	if err = syncLivestreams(); err != nil {
+		log.Fatalf("Could not get livestreams: %v", err)
+	}
+	if val := os.Getenv("delivery_concurrency"); val != "" {
+		if deliveryConcurrency, err = strconv.Atoi(val); err != nil || deliveryConcurrency < 1 {
+			log.Fatalf("delivery_concurrency must be a positive number, got %q", val)
+		}
+	}
 
 	// init bot
 	session, err := discordgo.New("Bot " + token)
@@ -323,73 +942,23 @@ func RunBot() {
 	}
 
 	// EVENT HANDLERS //
-	// Bot Added to Server
-	// FIXME: event fires when bot goes online
-	// session.AddHandler(func (s *discordgo.Session, gc *discordgo.GuildCreate) {
-	// 	sysChan := gc.SystemChannelID
-	// 	if sysChan != "" {
-	// 		// send to server's system msgs
-	// 		s.ChannelMessageSend(sysChan, helpIntro)
-	// 	} else {
-	// 		// TODO: send dm to admins
-	// 	}
-	// })
+	// Guild lifecycle
+	session.AddHandler(handleGuildCreate)
+	session.AddHandler(handleGuildDelete)
+	session.AddHandler(handleChannelDelete)
+	session.AddHandler(handleThreadDelete)
 
 	// Bot Interaction
 	session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		slog.Debug(fmt.Sprintf("Received interaction of type %v", i.Type))
-		// only commands
-		if i.Type != discordgo.InteractionApplicationCommand {
-			return
-		}
-
-		// "cast" InteractionData to ApplicationCommandInteractionData
-		data := i.ApplicationCommandData()
-		opts := parseArgs(data.Options)
-
-		slog.Debug(fmt.Sprintf("%s ran %s\n", interactionAuthor(i.Interaction), data.Name))
-		if len(opts) > 0 {
-			slog.Debug("Command options:")
-			for name, val := range opts {
-				slog.Debug(fmt.Sprintf("%s=%v\n", name, val))
-			}
-		}
-
-		// Command matching
-		switch data.Name {
-		case "help":
-			handleHelp(s, i, opts)
-		case "subscribe":
-			HandleSubscribe(s, i, opts)
-		case "unsubscribe":
-			HandleUnsubscribe(s, i, opts)
-		case "filter_games":
-			HandleFilterGames(s, i, opts)
-		case "check_subscription":
-			HandleCheckSubscription(s, i, opts)
-		case "add_ping_role":
-			HandleAddPingRole(s, i, opts)
-		case "remove_ping_role":
-			HandleRemovePingRole(s, i, opts)
-		case "create_ticker":
-			HandleCreateTicker(s, i, opts)
-		case "delete_ticker":
-			HandleDeleteTicker(s, i, opts)
-		case "active_codes":
-			HandleActiveCodes(s, i, opts)
-		case "check_tickers":
-			HandleGetTickers(s, i)
-		default:
-			slog.Warn(fmt.Sprintf("Tried to run an unimplemented command %s!!", data.Name))
-			if len(opts) > 0 {
-				slog.Debug("Command options:")
-				for name, val := range opts {
-					slog.Debug(fmt.Sprintf("%s=%v", name, val))
-				}
-			}
-			RespondPrivate(s, i, "command unimplemented")
+		switch i.Type {
+		case discordgo.InteractionApplicationCommand:
+			handleCommand(s, i)
+		case discordgo.InteractionApplicationCommandAutocomplete:
+			handleAutocomplete(s, i)
+		case discordgo.InteractionMessageComponent:
+			handleComponent(s, i)
 		}
-
 	})
 
 	// Bot ready
@@ -397,6 +966,10 @@ func RunBot() {
 		slog.Info(fmt.Sprintf("Logged in as %s", r.User.String()))
 	})
 
+	if err = seedGuilds(session); err != nil {
+		log.Fatalf("Could not record current guilds: %s", err)
+	}
+
 	// Start Discord bot session with handlers set //
 	err = session.Open()
 	if err != nil {
@@ -408,8 +981,12 @@ func RunBot() {
 	// wait for interrupt
 	intrpChan := make(chan os.Signal, 1)
 	signal.Notify(intrpChan, os.Interrupt)
-	go UpdateRoutine(session, intrpChan)
+	ctx, cancel := context.WithCancel(context.Background())
+	go UpdateRoutine(ctx, session, intrpChan)
+	go LivestreamRoutine(ctx, session)
+	go DigestRoutine(ctx, session)
 	<-intrpChan
+	cancel() // cut short deliveries in progress
 
 	if !UpdatingMutex.TryLock() {
 	slog.Info("Waiting until current update finishes to close...")
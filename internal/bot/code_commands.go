@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// most choices Discord shows for autocomplete
+const autocompleteLimit = 25
+
+func codeStatus(c db.CodeInfo) string {
+	switch {
+	case c.RemovedBy == db.RemovedByModerator:
+		return "confirmed expired by moderators"
+	case !c.Removed.IsZero():
+		return "removed"
+	case c.Livestream:
+		return "active (livestream)"
+	default:
+		return "active"
+	}
+}
+
+func codeChoices(query string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	codes, err := db.SearchCodes(strings.TrimSpace(query), autocompleteLimit)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not search codes for %q: %v", query, err))
+		return choices
+	}
+	for _, c := range codes {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name: fmt.Sprintf("%v (%v, %v)", c.Code, c.Game, codeStatus(c)),
+			Value: c.Code,
+		})
+	}
+	return choices
+}
+
+func codeInfoPrint(c db.CodeInfo) string {
+	out := fmt.Sprintf("### `%v` - %v\n", c.Code, c.Game)
+	out += c.Description + "\n"
+	out += fmt.Sprintf("**Status:** %v\n", codeStatus(c))
+	out += fmt.Sprintf("**Added:** <t:%v:f> (<t:%v:R>)\n", c.Added.Unix(), c.Added.Unix())
+	if !c.Removed.IsZero() {
+		out += fmt.Sprintf("**Removed:** <t:%v:f> (<t:%v:R>)\n", c.Removed.Unix(), c.Removed.Unix())
+	} else if url := util.CodeRedeemURL(c.Code, c.Game); url != nil {
+		out += fmt.Sprintf("**[Redeem](<%v>)**\n", *url)
+	}
+	return out
+}
+
+func HandleCode(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	code := strings.TrimSpace(opts["code"].StringValue())
+	codes, err := db.LookupCode(code)
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error looking up code: %v", err))
+		return
+	}
+	if len(codes) == 0 {
+		RespondPrivate(s, i, fmt.Sprintf("I haven't seen the code `%v`. It may be misspelled, or too old for me to know about.", code))
+		return
+	}
+
+	out := ""
+	for _, c := range codes {
+		out += codeInfoPrint(c) + "\n"
+	}
+	RespondPrivate(s, i, strings.Trim(out, " \t\n"))
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+)
+
+// A game's notification for a subscription. Remembers how far it got so
+// retries pick up where the last attempt left off.
+type notification struct {
+	sub db.Subscription
+	game string
+	msgs []*discordgo.MessageSend
+	sent int
+}
+
+// Post to wherever the subscription delivers to, passing opts to every request.
+func (n *notification) deliver(s *discordgo.Session, opts ...discordgo.RequestOption) error {
+	switch n.sub.Target.Mode {
+	case db.DeliverForum, db.DeliverThread:
+		return n.deliverToThread(s, opts...)
+	default:
+		return n.send(s, n.sub.ChannelID, opts...)
+	}
+}
+
+// Send the remaining messages to a channel.
+func (n *notification) send(s *discordgo.Session, channelID string, opts ...discordgo.RequestOption) error {
+	for n.sent < len(n.msgs) {
+		if _, err := s.ChannelMessageSendComplex(channelID, n.msgs[n.sent], opts...); err != nil {
+			return err
+		}
+		n.sent++
+	}
+	return nil
+}
+
+// Patches are delimited by livestream code drops, as each version's
+// special program comes with a new batch of them.
+func threadScopeKey(target db.DeliveryTarget, game string) string {
+	if target.ThreadScope != db.ThreadPerPatch {
+		return ""
+	}
+
+	latest, err := db.GetLatestLivestreamTime(game)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not get latest livestream time for %v; using one thread: %v", game, err))
+		return ""
+	}
+	if latest.IsZero() {
+		return ""
+	}
+	return latest.Format("2006-01-02")
+}
+
+func threadName(game string, scopeKey string) string {
+	if scopeKey == "" {
+		return fmt.Sprintf("%v codes", game)
+	}
+	return fmt.Sprintf("%v codes (livestream %v)", game, scopeKey)
+}
+
+// Reply in the subscription's thread for the game, starting one if it
+// doesn't exist yet or was deleted.
+func (n *notification) deliverToThread(s *discordgo.Session, opts ...discordgo.RequestOption) error {
+	sub, game := n.sub, n.game
+	scopeKey := threadScopeKey(sub.Target, game)
+
+	threadID, err := db.GetSubscriptionThread(sub.ChannelID, game, scopeKey)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if threadID != "" {
+		err = n.send(s, threadID, opts...)
+		if err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+			return err
+		}
+		slog.Info(fmt.Sprintf("Thread %v for %v is gone; starting a new one", threadID, sub.ChannelID))
+	}
+
+	var thread *discordgo.Channel
+	name := threadName(game, scopeKey)
+	if sub.Target.Mode == db.DeliverForum {
+		// forum posts open with the next message
+		thread, err = s.ForumThreadStartComplex(sub.Target.ForumID, &discordgo.ThreadStart{
+			Name: name,
+			AutoArchiveDuration: consts.ThreadArchiveDuration,
+		}, n.msgs[n.sent], opts...)
+		if err == nil {
+			n.sent++
+		}
+	} else {
+		thread, err = s.ThreadStartComplex(sub.ChannelID, &discordgo.ThreadStart{
+			Name: name,
+			AutoArchiveDuration: consts.ThreadArchiveDuration,
+			Type: discordgo.ChannelTypeGuildPublicThread,
+		}, opts...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = db.SetSubscriptionThread(sub.ChannelID, game, scopeKey, thread.ID); err != nil {
+		return err
+	}
+	return n.send(s, thread.ID, opts...)
+}
@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/internal/delivery"
+	"github.com/muskit/hoyocodes-discord-bot/internal/schedule"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+func digestLocation(d db.Digest) *time.Location {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Unknown digest timezone %q; using UTC", d.Timezone))
+		return time.UTC
+	}
+	return loc
+}
+
+// When a subscription's latest digest was due at or before now.
+func lastDigest(d db.Digest, now time.Time) time.Time {
+	return schedule.LastDigest(d.Frequency == db.DigestWeekly, d.Weekday, d.Minute, digestLocation(d), now)
+}
+
+func nextDigest(d db.Digest, now time.Time) time.Time {
+	return schedule.NextDigest(d.Frequency == db.DigestWeekly, d.Weekday, d.Minute, digestLocation(d), now)
+}
+
+func digestPrint(d db.Digest) string {
+	clock := fmt.Sprintf("%v (%v)", util.FormatClock(d.Minute), d.Timezone)
+	switch d.Frequency {
+	case db.DigestDaily:
+		return "daily at " + clock
+	case db.DigestWeekly:
+		return fmt.Sprintf("weekly on %v at %v", d.Weekday, clock)
+	}
+	return "off; each change is announced"
+}
+
+// Queue a game's changes for a subscription's next digest, per what it announces.
+func queueDigest(sub db.Subscription, game string, chgs CodeChanges) error {
+	now := time.Now()
+	queues := []struct {
+		announce bool
+		change db.DigestChange
+		codes [][]string
+	}{
+		{sub.AnnounceAdds, db.DigestAdded, chgs.Added},
+		{sub.AnnounceRems, db.DigestRemoved, chgs.Removed},
+		{sub.AnnounceRems, db.DigestFlagged, chgs.Flagged},
+	}
+	for _, q := range queues {
+		if !q.announce || len(q.codes) == 0 {
+			continue
+		}
+		if err := db.QueueDigestChanges(sub.ChannelID, game, q.change, q.codes, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Group a game's queued changes. Codes added and then removed are only
+// listed as removed.
+func queuedChanges(entries []db.DigestEntry) CodeChanges {
+	chgs := CodeChanges{}
+	removed := map[string]bool{}
+	for _, e := range entries {
+		code := []string{e.Code, e.Description}
+		switch e.Change {
+		case db.DigestRemoved:
+			chgs.Removed = append(chgs.Removed, code)
+			removed[e.Code] = true
+		case db.DigestFlagged:
+			chgs.Flagged = append(chgs.Flagged, code)
+		}
+	}
+	for _, e := range entries {
+		if e.Change == db.DigestAdded && !removed[e.Code] {
+			chgs.Added = append(chgs.Added, []string{e.Code, e.Description})
+		}
+	}
+	return chgs
+}
+
+// Summarize a game's queued changes along with its codes still active.
+// Codes added and removed since the last digest are only listed as removed.
+func digestContent(game string, d db.Digest, since time.Time, due time.Time, entries []db.DigestEntry) string {
+	chgs := queuedChanges(entries)
+	isNew := map[string]bool{}
+	for _, c := range chgs.Added {
+		isNew[c[0]] = true
+	}
+	active := [][]string{}
+	for _, c := range slices.Concat(tickerCodes(game, db.All, false), tickerCodes(game, db.All, true)) {
+		if !isNew[c[0]] {
+			active = append(active, c)
+		}
+	}
+
+	// dated in plain text for notification previews, where timestamps don't render
+	content := fmt.Sprintf("## %v digest for %v, %v\n", strings.ToUpper(string(d.Frequency[:1]))+string(d.Frequency[1:]), game, due.In(digestLocation(d)).Format("Mon 2 Jan"))
+	content += fmt.Sprintf("-# Changes since <t:%v:f>.\n", since.Unix())
+	sections := []struct {
+		heading string
+		codes [][]string
+		game *string
+	}{
+		{"**NEW:**", chgs.Added, &game},
+		{"**REMOVED:**", chgs.Removed, nil},
+		{"**REPORTEDLY EXPIRED:**", chgs.Flagged, nil},
+		{"**STILL ACTIVE:**", active, &game},
+	}
+	for _, section := range sections {
+		if len(section.codes) > 0 {
+			content += section.heading + "\n" + util.CodeListing(section.codes, section.game) + "\n"
+		}
+	}
+	if link, exists := consts.RedeemURL[game]; exists {
+		content += fmt.Sprintf("\n[Redemption page](<%v>)\n", link)
+	}
+	return content
+}
+
+// Sends digests when they're due, and changes held back during quiet hours
+// once they're over, until ctx is cancelled.
+func DigestRoutine(ctx context.Context, session *discordgo.Session) {
+	for {
+		sendDigests(ctx, session)
+		flushDeferred(ctx, session)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(consts.DigestCheckInterval):
+		}
+	}
+}
+
+// A subscription's changes for a game, as delivered together.
+type channelGame struct {
+	channelID string
+	game string
+}
+
+// Post every due digest, one message per game with changes. A game's queued
+// changes are kept for the next digest if its message fails.
+func sendDigests(ctx context.Context, session *discordgo.Session) {
+	if notificationsPaused.Load() {
+		return
+	}
+	subs, err := db.GetDigestSubscriptions()
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error getting digest subscriptions: %v", err))
+		return
+	}
+
+	now := time.Now()
+	dueAt := map[string]time.Time{}
+	sent := map[channelGame]bool{}
+	sentMutex := sync.Mutex{}
+	jobs := []delivery.Job{}
+	for _, sub := range subs {
+		due := lastDigest(sub.Digest, now)
+		if !sub.Digest.Last.Before(due) {
+			continue
+		}
+		dueAt[sub.ChannelID] = due
+
+		entries, err := db.GetDigestQueue(sub.ChannelID, due)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error getting digest queue of %v: %v", sub.ChannelID, err))
+			continue
+		}
+		gameEntries := map[string][]db.DigestEntry{}
+		for _, e := range entries {
+			gameEntries[e.Game] = append(gameEntries[e.Game], e)
+		}
+
+		for _, game := range consts.Games {
+			if len(gameEntries[game]) == 0 {
+				continue
+			}
+			content := digestContent(game, sub.Digest, sub.Digest.Last, due, gameEntries[game]) + "\n" + pingMentions(sub.ChannelID, game)
+			msgs := []*discordgo.MessageSend{}
+			for _, chunk := range util.SplitLines(content, consts.MessageContentLimit) {
+				msgs = append(msgs, &discordgo.MessageSend{Content: chunk})
+			}
+			n := &notification{sub: sub, game: game, msgs: msgs}
+			jobs = append(jobs, delivery.Job{
+				Route: sub.ChannelID,
+				Do: func(opts ...discordgo.RequestOption) error {
+					return n.deliver(session, opts...)
+				},
+				Done: func(err error) {
+					if err == nil {
+						sentMutex.Lock()
+						sent[channelGame{sub.ChannelID, game}] = true
+						sentMutex.Unlock()
+					}
+					handleNotifyError(sub, err)
+				},
+			})
+		}
+	}
+	if len(dueAt) == 0 {
+		return
+	}
+
+	stats := delivery.Run(ctx, deliveryConcurrency, consts.DeliveryMaxRetries, jobs)
+	slog.Info(fmt.Sprintf("Digest delivery: %v", stats))
+
+	for key := range sent {
+		if err := db.ClearDigestQueueGame(key.channelID, key.game, dueAt[key.channelID]); err != nil {
+			slog.Error(fmt.Sprintf("Error clearing %v digest queue of %v: %v", key.game, key.channelID, err))
+		}
+	}
+	for channelID, due := range dueAt {
+		if err := db.SetDigestLast(channelID, due); err != nil {
+			slog.Error(fmt.Sprintf("Error saving digest time of %v: %v", channelID, err))
+		}
+	}
+}
+
+func HandleDigest(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	sub, err := db.GetSubscription(i.ChannelID)
+	if err == sql.ErrNoRows {
+		RespondPrivate(s, i, fmt.Sprintf("Please subscribe <#%v> with `/subscribe` first.", i.ChannelID))
+		return
+	}
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error checking subscription for <#%v>: %v", i.ChannelID, err))
+		return
+	}
+
+	d := sub.Digest
+	d.Frequency = db.DigestFrequency(opts["frequency"].StringValue())
+	if val, exists := opts["time"]; exists {
+		if d.Minute, err = util.ParseClock(val.StringValue()); err != nil {
+			RespondPrivate(s, i, err.Error())
+			return
+		}
+	}
+	if val, exists := opts["day"]; exists {
+		d.Weekday = time.Weekday(val.IntValue())
+	}
+	if sub.Digest.Frequency == db.DigestOff {
+		// setting up; start from the server's timezone
+		d.Timezone = guildSettings(i.GuildID).Timezone
+	}
+	if val, exists := opts["timezone"]; exists {
+		loc, err := time.LoadLocation(strings.TrimSpace(val.StringValue()))
+		if err != nil || loc.String() == "Local" {
+			RespondPrivate(s, i, fmt.Sprintf("%q isn't a timezone; use a name like `Europe/Berlin` or `America/New_York`.", val.StringValue()))
+			return
+		}
+		d.Timezone = loc.String()
+	}
+	// digests due before now are skipped, not sent right away
+	now := time.Now()
+	d.Last = now
+
+	if err = db.SetSubscriptionDigest(i.ChannelID, d); err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error updating digest for <#%v>: %v", i.ChannelID, err))
+		return
+	}
+	if d.Frequency == db.DigestOff {
+		if err = db.ClearDigestQueue(i.ChannelID, now); err != nil {
+			slog.Error(fmt.Sprintf("Error clearing digest queue of %v: %v", i.ChannelID, err))
+		}
+		RespondPrivate(s, i, fmt.Sprintf("<#%v> will be notified of each change again.", i.ChannelID))
+		return
+	}
+	RespondPrivate(s, i, fmt.Sprintf("Changes will be batched into a %v digest in <#%v>, %v. The next one is <t:%v:F>.",
+		d.Frequency, i.ChannelID, digestPrint(d), nextDigest(d, now).Unix()))
+}
@@ -0,0 +1,26 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+)
+
+func TestQueuedChanges(t *testing.T) {
+	entries := []db.DigestEntry{
+		{Game: "Genshin Impact", Code: "KEPT", Description: "a", Change: db.DigestAdded},
+		{Game: "Genshin Impact", Code: "GONE", Description: "b", Change: db.DigestAdded},
+		{Game: "Genshin Impact", Code: "OLD", Description: "c", Change: db.DigestFlagged},
+		{Game: "Genshin Impact", Code: "GONE", Description: "b", Change: db.DigestRemoved},
+	}
+	got := queuedChanges(entries)
+	expected := CodeChanges{
+		Added: [][]string{{"KEPT", "a"}},
+		Removed: [][]string{{"GONE", "b"}},
+		Flagged: [][]string{{"OLD", "c"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("queuedChanges() = %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// custom IDs:
+// expiry:<game> - button asking which code expired
+// expiry_vote:<game> - code picked
+// expiry_review:<confirm|clear>:<game>:<code> - moderator decision
+const (
+	expiryPrefix = "expiry"
+	expiryVotePrefix = "expiry_vote"
+	expiryReviewPrefix = "expiry_review"
+)
+
+// Votes within expiryVoteWindow that flag a code as reportedly expired; set
+// by the expiry_vote_threshold and expiry_vote_window env vars.
+var (
+	expiryVoteThreshold = consts.DefaultExpiryVoteThreshold
+	expiryVoteWindow = consts.DefaultExpiryVoteWindow
+)
+
+// Whether subscribers are told about flagged codes; set by the
+// announce_expiry_flags env var.
+var announceExpiryFlags = false
+
+// Buttons for reporting an expired code of each game.
+func expiryButtons(games []string) []discordgo.MessageComponent {
+	buttons := []discordgo.MessageComponent{}
+	for _, game := range games {
+		label := "Report expired code"
+		if len(games) > 1 {
+			label = "Expired code: " + game
+		}
+		buttons = append(buttons, discordgo.Button{
+			Label: label,
+			Style: discordgo.SecondaryButton,
+			CustomID: expiryPrefix + ":" + game,
+		})
+	}
+
+	rows := []discordgo.MessageComponent{}
+	for len(buttons) > 0 {
+		n := min(len(buttons), consts.RowButtonLimit)
+		rows = append(rows, discordgo.ActionsRow{Components: buttons[:n]})
+		buttons = buttons[n:]
+	}
+	return rows
+}
+
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit-1]) + "…"
+}
+
+// arg: <game>
+func HandleExpiryClick(s *discordgo.Session, i *discordgo.InteractionCreate, game string) {
+	codes := append(db.GetCodes(game, db.All, false), db.GetCodes(game, db.All, true)...)
+	if len(codes) == 0 {
+		RespondPrivate(s, i, fmt.Sprintf("There are no active codes for %v.", game))
+		return
+	}
+	// most recent ones, as the list is limited
+	if len(codes) > autocompleteLimit {
+		codes = codes[len(codes)-autocompleteLimit:]
+	}
+
+	options := []discordgo.SelectMenuOption{}
+	for _, code := range codes {
+		options = append(options, discordgo.SelectMenuOption{
+			Label: code[0],
+			Value: code[0],
+			Description: truncate(code[1], 100),
+		})
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Which %v code didn't work because it expired?", game),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.SelectMenu{
+							CustomID: expiryVotePrefix + ":" + game,
+							Placeholder: "Pick the expired code",
+							Options: options,
+						},
+					},
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not ask for expired code: %v", err))
+	}
+}
+
+// arg: <game>
+func HandleExpiryVote(s *discordgo.Session, i *discordgo.InteractionCreate, game string) {
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return
+	}
+	code := values[0]
+
+	content := fmt.Sprintf("Thanks, your report that `%v` expired was recorded!", code)
+	now := time.Now()
+	if err := db.AddExpiryVote(code, game, interactionAuthor(i.Interaction).ID, now); err != nil {
+		content = fmt.Sprintf("Error recording report: %v", err)
+	} else if votes, err := db.CountExpiryVotes(code, game, now.Add(-expiryVoteWindow)); err != nil {
+		slog.Error(fmt.Sprintf("Error counting expiry votes for %v: %v", code, err))
+	} else if votes >= expiryVoteThreshold {
+		flagged, err := db.FlagCode(code, game)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error flagging %v as expired: %v", code, err))
+		} else if flagged {
+			codeFlagged(s, code, game, votes)
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not confirm expiry report: %v", err))
+	}
+}
+
+func codeDescription(code string, game string) string {
+	codes, err := db.LookupCode(code)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not look up %v: %v", code, err))
+	}
+	for _, c := range codes {
+		if c.Game == game {
+			return c.Description
+		}
+	}
+	return ""
+}
+
+// Let moderators review a newly flagged code, and show the flag on tickers.
+func codeFlagged(s *discordgo.Session, code string, game string, votes int) {
+	slog.Info(fmt.Sprintf("%v code %v reportedly expired (%v votes)", game, code, votes))
+	desc := codeDescription(code, game)
+
+	if reviewChannelID != "" {
+		id := func(action string) string {
+			return fmt.Sprintf("%v:%v:%v:%v", expiryReviewPrefix, action, game, code)
+		}
+		_, err := s.ChannelMessageSendComplex(reviewChannelID, &discordgo.MessageSend{
+			Content: fmt.Sprintf(
+				"**Code reportedly expired**\n" +
+				"**Game:** %v\n" +
+				"**Code:** `%v` - %v\n" +
+				"%v users reported it within %v.",
+				game, code, desc, votes, util.FormatInterval(expiryVoteWindow)),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{Label: "Confirm expired", Style: discordgo.DangerButton, CustomID: id("confirm")},
+						discordgo.Button{Label: "Clear flag", Style: discordgo.SecondaryButton, CustomID: id("clear")},
+					},
+				},
+			},
+		})
+		if err != nil {
+			slog.Error(fmt.Sprintf("Could not post flagged code %v for review: %v", code, err))
+		}
+	}
+
+	changes := map[string]*CodeChanges{}
+	if announceExpiryFlags {
+		changes[game] = &CodeChanges{Flagged: [][]string{{code, desc}}}
+	}
+	go announceCodeChanges(s, changes)
+}
+
+// arg: <confirm|clear>:<game>:<code>
+func HandleExpiryReview(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageMessages == 0 {
+		RespondPrivate(s, i, "Only moderators can review flagged codes.")
+		return
+	}
+	action, rest, _ := strings.Cut(arg, ":")
+	game, code, _ := strings.Cut(rest, ":")
+	reviewer := interactionAuthor(i.Interaction).ID
+
+	outcome := ""
+	switch action {
+	case "confirm":
+		desc := codeDescription(code, game)
+		// kept removed on later scrapes even if the source still lists it
+		if err := db.ExpireCode(code, game); err != nil {
+			outcome = fmt.Sprintf("Error removing code: %v", err)
+			break
+		}
+		if err := db.ClearCodeFlag(code, game); err != nil {
+			slog.Error(fmt.Sprintf("Error clearing flag of removed code %v: %v", code, err))
+		}
+		go announceCodeChanges(s, map[string]*CodeChanges{game: {Removed: [][]string{{code, desc}}}})
+		outcome = fmt.Sprintf("**Confirmed expired** by <@%v>; the code was removed.", reviewer)
+	case "clear":
+		if err := db.ClearCodeFlag(code, game); err != nil {
+			outcome = fmt.Sprintf("Error clearing flag: %v", err)
+			break
+		}
+		go announceCodeChanges(s, map[string]*CodeChanges{})
+		outcome = fmt.Sprintf("**Flag cleared** by <@%v>.", reviewer)
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content: i.Message.Content + "\n" + outcome,
+			Components: []discordgo.MessageComponent{},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not update flagged code review: %v", err))
+	}
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+)
+
+// Record the guilds the bot is already in when none are known yet (ie. on
+// first run), so they aren't welcomed as new ones.
+func seedGuilds(s *discordgo.Session) error {
+	n, err := db.CountGuilds()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	after := ""
+	for {
+		guilds, err := s.UserGuilds(200, "", after, false)
+		if err != nil {
+			return err
+		}
+		for _, g := range guilds {
+			if _, err = db.AddGuild(g.ID); err != nil {
+				return err
+			}
+		}
+		if len(guilds) < 200 {
+			break
+		}
+		after = guilds[len(guilds)-1].ID
+	}
+	slog.Info("Recorded guilds the bot is already in")
+	return nil
+}
+
+// Discord replays GuildCreate for every guild on connecting; only guilds
+// missing from the Guilds table are new.
+func handleGuildCreate(s *discordgo.Session, gc *discordgo.GuildCreate) {
+	if gc.Unavailable {
+		return
+	}
+
+	isNew, err := db.AddGuild(gc.ID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error recording guild %v: %v", gc.ID, err))
+		return
+	}
+	if !isNew {
+		return
+	}
+	slog.Info(fmt.Sprintf("Joined guild %v (%v)", gc.Name, gc.ID))
+	welcomeGuild(s, gc.Guild)
+}
+
+func handleGuildDelete(s *discordgo.Session, gd *discordgo.GuildDelete) {
+	// outages make guilds unavailable without the bot leaving them
+	if gd.Unavailable {
+		return
+	}
+
+	slog.Info(fmt.Sprintf("Removed from guild %v; deleting its subscriptions and tickers", gd.ID))
+	if err := db.DeleteGuildSubscriptions(gd.ID); err != nil {
+		slog.Error(fmt.Sprintf("Error deleting subscriptions of guild %v: %v", gd.ID, err))
+	}
+	if err := db.RemoveGuildTickers(gd.ID); err != nil {
+		slog.Error(fmt.Sprintf("Error removing tickers of guild %v: %v", gd.ID, err))
+	}
+	// welcome it again if it re-adds the bot
+	if err := db.RemoveGuild(gd.ID); err != nil {
+		slog.Error(fmt.Sprintf("Error forgetting guild %v: %v", gd.ID, err))
+	}
+}
+
+// Forget everything tied to a channel or thread that no longer exists.
+func cleanupChannel(c *discordgo.Channel) {
+	if err := db.DeleteSubscription(c.ID); err != nil {
+		slog.Error(fmt.Sprintf("Error deleting subscription of deleted channel %v: %v", c.ID, err))
+	}
+	if err := db.RemoveChannelTickers(c.ID); err != nil {
+		slog.Error(fmt.Sprintf("Error removing tickers of deleted channel %v: %v", c.ID, err))
+	}
+
+	switch c.Type {
+	case discordgo.ChannelTypeGuildForum:
+		if err := db.ResetForumSubscriptions(c.ID); err != nil {
+			slog.Error(fmt.Sprintf("Error resetting subscriptions to deleted forum %v: %v", c.ID, err))
+		}
+	case discordgo.ChannelTypeGuildPublicThread, discordgo.ChannelTypeGuildPrivateThread:
+		if err := db.ForgetSubscriptionThread(c.ID); err != nil {
+			slog.Error(fmt.Sprintf("Error forgetting deleted thread %v: %v", c.ID, err))
+		}
+	}
+}
+
+func handleChannelDelete(s *discordgo.Session, cd *discordgo.ChannelDelete) {
+	slog.Debug(fmt.Sprintf("Channel %v deleted", cd.ID))
+	cleanupChannel(cd.Channel)
+}
+
+func handleThreadDelete(s *discordgo.Session, td *discordgo.ThreadDelete) {
+	slog.Debug(fmt.Sprintf("Thread %v deleted", td.ID))
+	cleanupChannel(td.Channel)
+}
@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/internal/delivery"
+	"github.com/muskit/hoyocodes-discord-bot/internal/schedule"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// How late a roundup may still be posted, eg. after downtime.
+const livestreamRoundupGrace = 24 * time.Hour
+
+func livestreamTitle(l db.Livestream) string {
+	if l.Title != "" {
+		return l.Title
+	}
+	return fmt.Sprintf("%v special program", l.Game)
+}
+
+// Add livestreams from the calendar file to the DB; ones already there are kept.
+func seedLivestreams(path string) error {
+	windows, err := schedule.LoadCalendar(path)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, w := range windows {
+		isNew, err := db.AddLivestream(db.Livestream{Game: w.Game, Title: w.Title, Start: w.Start, End: w.End})
+		if err != nil {
+			return err
+		}
+		if isNew {
+			added++
+		}
+	}
+	slog.Info(fmt.Sprintf("Added %v of %v livestreams from %v", added, len(windows), path))
+	return nil
+}
+
+// Poll games faster during their upcoming and ongoing livestreams.
+func syncLivestreams() error {
+	now := time.Now()
+	streams, err := db.GetLivestreams(now.Add(-consts.LivestreamPollTail))
+	if err != nil {
+		return err
+	}
+	windows := []schedule.Window{}
+	for _, l := range streams {
+		windows = append(windows, schedule.Window{Game: l.Game, Title: l.Title, Start: l.Start, End: l.End})
+	}
+	scrapeSchedule.SetWindows(windows, now)
+	return nil
+}
+
+// Posts livestream countdowns and roundups when they're due, until ctx is cancelled.
+func LivestreamRoutine(ctx context.Context, session *discordgo.Session) {
+	for {
+		checkLivestreams(ctx, session)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(consts.LivestreamCheckInterval):
+		}
+	}
+}
+
+func checkLivestreams(ctx context.Context, session *discordgo.Session) {
+	now := time.Now()
+	streams, err := db.GetLivestreams(now.Add(-consts.LivestreamPollTail - livestreamRoundupGrace))
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error getting livestreams: %v", err))
+		return
+	}
+
+	for _, l := range streams {
+		if !l.Announced && now.After(l.Start.Add(-consts.LivestreamAnnounceLead)) && now.Before(l.End) {
+			announceLivestream(ctx, session, l)
+			if err := db.MarkLivestreamAnnounced(l.ID); err != nil {
+				slog.Error(fmt.Sprintf("Error marking livestream %v announced: %v", l.ID, err))
+			}
+		}
+		// by now the fast polling after the stream is over
+		if !l.RoundedUp && now.After(l.End.Add(consts.LivestreamPollTail)) {
+			if err := roundUpLivestream(ctx, session, l, now); err != nil {
+				slog.Error(fmt.Sprintf("Error rounding up livestream %v: %v", l.ID, err))
+				continue
+			}
+			if err := db.MarkLivestreamRoundedUp(l.ID); err != nil {
+				slog.Error(fmt.Sprintf("Error marking livestream %v rounded up: %v", l.ID, err))
+			}
+		}
+	}
+}
+
+// Send a message to every subscription announcing additions for the game,
+// with their ping roles. content is rendered in each guild's timezone.
+// Guilds in quiet hours only get urgent messages, if they let livestream
+// codes through.
+func notifyLivestream(ctx context.Context, session *discordgo.Session, game string, urgent bool, content func(loc *time.Location) string) error {
+	if notificationsPaused.Load() {
+		slog.Info("Notifications are paused; not posting livestream message")
+		return nil
+	}
+	subscriptions, err := db.GetGameSubscriptions(game)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	jobs := []delivery.Job{}
+	for _, sub := range subscriptions {
+		if !sub.AnnounceAdds {
+			continue
+		}
+		g := guildSettings(sub.GuildID)
+		if inQuietHours(g, now) && (!urgent || !g.LivestreamBypass) {
+			continue
+		}
+		msgs := []*discordgo.MessageSend{}
+		for _, chunk := range util.SplitLines(content(guildLocation(g))+"\n"+pingMentions(sub.ChannelID, game), consts.MessageContentLimit) {
+			msgs = append(msgs, &discordgo.MessageSend{Content: chunk})
+		}
+		n := &notification{sub: sub, game: game, msgs: msgs}
+		jobs = append(jobs, delivery.Job{
+			Route: sub.ChannelID,
+			Do: func(opts ...discordgo.RequestOption) error {
+				return n.deliver(session, opts...)
+			},
+			Done: func(err error) {
+				handleNotifyError(sub, err)
+			},
+		})
+	}
+	stats := delivery.Run(ctx, deliveryConcurrency, consts.DeliveryMaxRetries, jobs)
+	slog.Info(fmt.Sprintf("Livestream delivery for %v: %v", game, stats))
+	return nil
+}
+
+func announceLivestream(ctx context.Context, session *discordgo.Session, l db.Livestream) {
+	slog.Info(fmt.Sprintf("Announcing livestream %v of %v", l.ID, l.Game))
+	content := func(loc *time.Location) string {
+		// the heading shows in notification previews, where timestamps don't render
+		out := fmt.Sprintf("## %v livestream at %v!\n", l.Game, localTimePrint(l.Start, loc))
+		out += fmt.Sprintf("**%v** airs <t:%v:R>. ", livestreamTitle(l), l.Start.Unix())
+		out += "Its codes usually expire within a day, so they'll be posted here as soon as they're found."
+		return out
+	}
+	if err := notifyLivestream(ctx, session, l.Game, true, content); err != nil {
+		slog.Error(fmt.Sprintf("Error announcing livestream %v: %v", l.ID, err))
+	}
+}
+
+// Post every code found since the stream started; nothing if there were none.
+func roundUpLivestream(ctx context.Context, session *discordgo.Session, l db.Livestream, now time.Time) error {
+	codes, err := db.GetLivestreamCodes(l.Game, l.Start, now)
+	if err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		slog.Info(fmt.Sprintf("No codes found for livestream %v of %v; skipping roundup", l.ID, l.Game))
+		return nil
+	}
+
+	slog.Info(fmt.Sprintf("Rounding up %v codes of livestream %v of %v", len(codes), l.ID, l.Game))
+	content := fmt.Sprintf("## Codes from the %v livestream\n", l.Game)
+	content += fmt.Sprintf("All codes from **%v**; redeem them soon!\n", livestreamTitle(l))
+	content += util.CodeListing(codes, &l.Game) + "\n"
+	if link, exists := consts.RedeemURL[l.Game]; exists {
+		content += fmt.Sprintf("\n[Redemption page](<%v>)\n", link)
+	}
+	// the codes themselves were announced, or are held back, already
+	return notifyLivestream(ctx, session, l.Game, false, func(*time.Location) string { return content })
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// Build the messages announcing a game's code changes, split to stay
+// within Discord's message limits. mentions is appended to the content.
+func notifyMessages(game string, chgs CodeChanges, format db.NotificationFormat, mentions string) []*discordgo.MessageSend {
+	msgs := []*discordgo.MessageSend{}
+	if format == db.FormatEmbed {
+		msgs = packMessages(mentions, notifyEmbeds(game, chgs), redeemButtons(game, chgs.Added))
+	} else {
+		for _, chunk := range util.SplitLines(notifyContent(game, chgs)+"\n"+mentions, consts.MessageContentLimit) {
+			msgs = append(msgs, &discordgo.MessageSend{Content: chunk})
+		}
+	}
+
+	if len(chgs.Added) > 0 {
+		last := msgs[len(msgs)-1]
+		if len(last.Components) < consts.MessageRowLimit {
+			last.Components = append(last.Components, expiryButtons([]string{game})...)
+		} else {
+			msgs = append(msgs, &discordgo.MessageSend{
+				Content: "-# Code didn't work?",
+				Components: expiryButtons([]string{game}),
+			})
+		}
+	}
+	return msgs
+}
+
+func notifyEmbeds(game string, chgs CodeChanges) []*discordgo.MessageEmbed {
+	fieldLists := [][]*discordgo.MessageEmbedField{}
+
+	if len(chgs.Added) > 0 {
+		fields := []*discordgo.MessageEmbedField{
+			{
+				Name: "--- New ---",
+			},
+		}
+		fields = appendCodeFields(fields, chgs.Added, game)
+		fieldLists = append(fieldLists, util.DownstackIntoSlices(fields, consts.EmbedFieldLimit)...)
+	}
+	if len(chgs.Removed) > 0 {
+		fields := []*discordgo.MessageEmbedField{
+			{
+				Name: "--- Removed ---",
+			},
+		}
+		// no redeem links for removed codes
+		fields = appendCodeFields(fields, chgs.Removed, "")
+		fieldLists = append(fieldLists, util.DownstackIntoSlices(fields, consts.EmbedFieldLimit)...)
+	}
+	if len(chgs.Flagged) > 0 {
+		fields := []*discordgo.MessageEmbedField{
+			{
+				Name: "--- Reportedly expired ---",
+			},
+		}
+		fields = appendCodeFields(fields, chgs.Flagged, "")
+		fieldLists = append(fieldLists, util.DownstackIntoSlices(fields, consts.EmbedFieldLimit)...)
+	}
+
+	_, updateTime, err := db.GetScrapeTimes(game)
+	if err != nil {
+		log.Fatalf("Error getting scrape times for %v: %v", game, err)
+	}
+	footerFields := []*discordgo.MessageEmbedField{}
+	if link, exists := consts.RedeemURL[game]; exists {
+		footerFields = append(footerFields, &discordgo.MessageEmbedField{
+			Value: fmt.Sprintf("**[Redemption page](%v)**", link),
+		})
+	}
+	footerFields = append(footerFields, &discordgo.MessageEmbedField{
+		Value: fmt.Sprintf("-# [source](%v) updated <t:%v:R>.", consts.ArticleURL[game], updateTime.Unix()),
+	})
+
+	return gameEmbeds(game, fmt.Sprintf("Codes updated for %v!", game), fieldLists, footerFields)
+}
+
+// Link buttons to redeem each code; none if the game has no redemption page.
+func redeemButtons(game string, codes [][]string) []discordgo.MessageComponent {
+	buttons := []discordgo.MessageComponent{}
+	for _, code := range codes {
+		url := util.CodeRedeemURL(code[0], game)
+		if url == nil {
+			break
+		}
+		buttons = append(buttons, discordgo.Button{
+			Label: code[0],
+			Style: discordgo.LinkButton,
+			URL: *url,
+		})
+	}
+	return buttons
+}
+
+// Characters of an embed counted towards a message's embed limit.
+func embedLength(e *discordgo.MessageEmbed) int {
+	n := utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+	if e.Footer != nil {
+		n += utf8.RuneCountInString(e.Footer.Text)
+	}
+	if e.Author != nil {
+		n += utf8.RuneCountInString(e.Author.Name)
+	}
+	for _, f := range e.Fields {
+		n += utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+	}
+	return n
+}
+
+// Spread embeds and buttons over as many messages as Discord's limits
+// require. content goes on the first message.
+func packMessages(content string, embeds []*discordgo.MessageEmbed, buttons []discordgo.MessageComponent) []*discordgo.MessageSend {
+	msgs := []*discordgo.MessageSend{}
+	cur := &discordgo.MessageSend{Content: content}
+	chars := 0
+	for _, e := range embeds {
+		n := embedLength(e)
+		if len(cur.Embeds) == consts.MessageEmbedLimit ||
+			(len(cur.Embeds) > 0 && chars+n > consts.MessageEmbedCharLimit) {
+			msgs = append(msgs, cur)
+			cur = &discordgo.MessageSend{}
+			chars = 0
+		}
+		cur.Embeds = append(cur.Embeds, e)
+		chars += n
+	}
+	msgs = append(msgs, cur)
+
+	// attach button rows from the last message on, so links follow the codes
+	rows := []discordgo.MessageComponent{}
+	for _, row := range util.DownstackIntoSlices(buttons, consts.RowButtonLimit) {
+		if len(row) > 0 {
+			rows = append(rows, discordgo.ActionsRow{Components: row})
+		}
+	}
+	rowChunks := util.DownstackIntoSlices(rows, consts.MessageRowLimit)
+	for i, chunk := range rowChunks {
+		if len(chunk) == 0 {
+			continue
+		}
+		if i == 0 {
+			msgs[len(msgs)-1].Components = chunk
+		} else {
+			msgs = append(msgs, &discordgo.MessageSend{
+				Content: "-# More redemption links",
+				Components: chunk,
+			})
+		}
+	}
+	return msgs
+}
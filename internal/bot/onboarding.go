@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+)
+
+// custom ID: setup_wizard:<subscribe|ticker>
+const setupWizardPrefix = "setup_wizard"
+
+func setupWizardComponents() []discordgo.MessageComponent {
+	channelTypes := []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					MenuType: discordgo.ChannelSelectMenu,
+					CustomID: setupWizardPrefix + ":subscribe",
+					Placeholder: "Admins: pick a channel to notify of new codes",
+					ChannelTypes: channelTypes,
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					MenuType: discordgo.ChannelSelectMenu,
+					CustomID: setupWizardPrefix + ":ticker",
+					Placeholder: "Admins: pick a channel to post a ticker in",
+					ChannelTypes: channelTypes,
+				},
+			},
+		},
+	}
+}
+
+// Introduce the bot to a new guild in its system channel, with a setup
+// wizard. Failing that, DM whoever added the bot, or the owner.
+func welcomeGuild(s *discordgo.Session, g *discordgo.Guild) {
+	if g.SystemChannelID != "" {
+		// send to server's system msgs
+		_, err := s.ChannelMessageSendComplex(g.SystemChannelID, &discordgo.MessageSend{
+			Content: helpIntro,
+			Components: setupWizardComponents(),
+		})
+		if err == nil {
+			return
+		}
+		slog.Warn(fmt.Sprintf("Could not welcome guild %v in its system channel: %v", g.ID, err))
+	}
+
+	userID := guildInviter(s, g.ID)
+	if userID == "" {
+		userID = g.OwnerID
+	}
+	dm, err := s.UserChannelCreate(userID)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not DM %v to welcome guild %v: %v", userID, g.ID, err))
+		return
+	}
+
+	msg := fmt.Sprintf(
+		"Thanks for adding me to **%v**!\n" +
+		"I couldn't post in its system channel, so here's how to get started. " +
+		"Run `/setup` in a channel that should be notified of new codes, or `/create_ticker` where a list of active codes should be kept up to date.\n\n%v",
+		g.Name, helpIntro)
+	if _, err = s.ChannelMessageSend(dm.ID, msg); err != nil {
+		slog.Warn(fmt.Sprintf("Could not DM %v to welcome guild %v: %v", userID, g.ID, err))
+	}
+}
+
+// The user who added the bot to a guild; empty if the audit log can't be read.
+func guildInviter(s *discordgo.Session, guildID string) string {
+	log, err := s.GuildAuditLog(guildID, "", "", int(discordgo.AuditLogActionBotAdd), 10)
+	if err != nil {
+		slog.Debug(fmt.Sprintf("Could not read audit log of %v: %v", guildID, err))
+		return ""
+	}
+	for _, entry := range log.AuditLogEntries {
+		if entry.TargetID == s.State.User.ID {
+			return entry.UserID
+		}
+	}
+	return ""
+}
+
+// arg: subscribe or ticker
+func HandleSetupWizard(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	if i.Member == nil || i.Member.Permissions&adminCmdFlag == 0 {
+		RespondPrivate(s, i, "Only server admins can set me up.")
+		return
+	}
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		RespondPrivate(s, i, "Please pick a channel.")
+		return
+	}
+	channelID := values[0]
+
+	switch arg {
+	case "subscribe":
+		target := db.DeliveryTarget{Mode: db.DeliverChannel, ThreadScope: db.ThreadPerGame}
+		err := db.CreateSubscription(channelID, i.GuildID, true, false, target, db.FormatText)
+		if db.IsDuplicateErr(err) {
+			RespondPrivate(s, i, fmt.Sprintf("<#%v> is already subscribed; run `/subscribe` there to change its settings.", channelID))
+			return
+		}
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Error trying to create subscription for <#%v>: %v", channelID, err))
+			return
+		}
+		RespondPrivate(s, i, fmt.Sprintf(
+			"Successfully subscribed <#%v> to new codes for all games!\n" +
+			"Run `/filter_games` or `/add_ping_role` there to fine-tune it.", channelID))
+	case "ticker":
+		RespondPrivate(s, i, postTicker(s, channelID, i.GuildID, []string{}, db.StyleEmbed))
+	default:
+		slog.Warn(fmt.Sprintf("Unknown setup wizard step %v", arg))
+	}
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// custom ID: page:<interaction ID>:<page index>
+const pagePrefix = "page"
+
+// ephemeral messages can't be edited after the interaction token expires
+const pageLifetime = 15 * time.Minute
+
+type pagedResponse struct {
+	pages []string
+	expires time.Time
+}
+
+var (
+	pagedResponses = map[string]*pagedResponse{}
+	pagedResponsesMutex = sync.Mutex{}
+)
+
+func storePages(id string, pages []string) {
+	pagedResponsesMutex.Lock()
+	defer pagedResponsesMutex.Unlock()
+
+	now := time.Now()
+	for key, resp := range pagedResponses {
+		if now.After(resp.expires) {
+			delete(pagedResponses, key)
+		}
+	}
+	pagedResponses[id] = &pagedResponse{pages: pages, expires: now.Add(pageLifetime)}
+}
+
+func getPages(id string) []string {
+	pagedResponsesMutex.Lock()
+	defer pagedResponsesMutex.Unlock()
+
+	resp, exists := pagedResponses[id]
+	if !exists || time.Now().After(resp.expires) {
+		return nil
+	}
+	return resp.pages
+}
+
+func pageButtons(id string, page int, count int) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label: "Prev",
+					Style: discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("%v:%v:%v", pagePrefix, id, page-1),
+					Disabled: page == 0,
+				},
+				discordgo.Button{
+					Label: "Next",
+					Style: discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("%v:%v:%v", pagePrefix, id, page+1),
+					Disabled: page == count-1,
+				},
+			},
+		},
+	}
+}
+
+// Respond privately with the first of several pages, with buttons to flip through them.
+func respondPrivatePages(s *discordgo.Session, i *discordgo.InteractionCreate, pages []string) error {
+	storePages(i.ID, pages)
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: pages[0],
+			Components: pageButtons(i.ID, 0, len(pages)),
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// arg: <interaction ID>:<page index>
+func HandlePageClick(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	id, pageStr, _ := strings.Cut(arg, ":")
+	page, err := strconv.Atoi(pageStr)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Bad page button %v: %v", arg, err))
+		return
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Content: "This listing has expired; please run the command again.",
+		Components: []discordgo.MessageComponent{},
+	}
+	if pages := getPages(id); pages != nil && page >= 0 && page < len(pages) {
+		data.Content = pages[page]
+		data.Components = pageButtons(id, page, len(pages))
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not flip page: %v", err))
+	}
+}
@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/internal/delivery"
+	"github.com/muskit/hoyocodes-discord-bot/internal/schedule"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// A guild's settings; the defaults if they can't be read.
+func guildSettings(guildID string) db.GuildSettings {
+	g, err := db.GetGuildSettings(guildID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error getting settings of guild %v; using defaults: %v", guildID, err))
+		return db.DefaultGuildSettings
+	}
+	return g
+}
+
+func guildLocation(g db.GuildSettings) *time.Location {
+	loc, err := time.LoadLocation(g.Timezone)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Unknown guild timezone %q; using UTC", g.Timezone))
+		return time.UTC
+	}
+	return loc
+}
+
+func inQuietHours(g db.GuildSettings, now time.Time) bool {
+	return schedule.InQuietHours(g.QuietStart, g.QuietEnd, guildLocation(g), now)
+}
+
+// A time spelled out in a timezone, for where Discord timestamps don't
+// render, eg. thread names and notification previews.
+func localTimePrint(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("Mon 2 Jan 15:04 MST")
+}
+
+func quietHoursPrint(g db.GuildSettings) string {
+	if g.QuietStart == g.QuietEnd {
+		return "off"
+	}
+	out := fmt.Sprintf("%v to %v (%v)", util.FormatClock(g.QuietStart), util.FormatClock(g.QuietEnd), g.Timezone)
+	if g.LivestreamBypass {
+		out += "; livestream codes are still announced"
+	}
+	return out
+}
+
+// Split changes for a guild in quiet hours into those to announce anyway,
+// livestream codes if the guild allows it, and those to hold until after.
+func splitQuietChanges(g db.GuildSettings, chgs CodeChanges) (urgent CodeChanges, deferred CodeChanges) {
+	deferred = CodeChanges{Removed: chgs.Removed, Flagged: chgs.Flagged, Livestream: chgs.Livestream}
+	urgent = CodeChanges{Livestream: chgs.Livestream}
+	for _, c := range chgs.Added {
+		if g.LivestreamBypass && chgs.Livestream[c[0]] {
+			urgent.Added = append(urgent.Added, c)
+		} else {
+			deferred.Added = append(deferred.Added, c)
+		}
+	}
+	return urgent, deferred
+}
+
+// Announce changes held back during quiet hours that have since ended.
+func flushDeferred(ctx context.Context, session *discordgo.Session) {
+	if notificationsPaused.Load() {
+		return
+	}
+	subs, err := db.GetDeferredSubscriptions()
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error getting subscriptions with deferred changes: %v", err))
+		return
+	}
+
+	now := time.Now()
+	sent := map[channelGame]bool{}
+	sentMutex := sync.Mutex{}
+	jobs := []delivery.Job{}
+	for _, sub := range subs {
+		if inQuietHours(guildSettings(sub.GuildID), now) {
+			continue
+		}
+		entries, err := db.GetDigestQueue(sub.ChannelID, now)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error getting deferred changes of %v: %v", sub.ChannelID, err))
+			continue
+		}
+		gameEntries := map[string][]db.DigestEntry{}
+		for _, e := range entries {
+			gameEntries[e.Game] = append(gameEntries[e.Game], e)
+		}
+
+		for _, game := range consts.Games {
+			if len(gameEntries[game]) == 0 {
+				continue
+			}
+			note := "-# Held back during quiet hours.\n" + pingMentions(sub.ChannelID, game)
+			n := &notification{sub: sub, game: game, msgs: notifyMessages(game, queuedChanges(gameEntries[game]), sub.Format, note)}
+			jobs = append(jobs, delivery.Job{
+				Route: sub.ChannelID,
+				Do: func(opts ...discordgo.RequestOption) error {
+					return n.deliver(session, opts...)
+				},
+				Done: func(err error) {
+					if err == nil {
+						sentMutex.Lock()
+						sent[channelGame{sub.ChannelID, game}] = true
+						sentMutex.Unlock()
+					}
+					handleNotifyError(sub, err)
+				},
+			})
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	stats := delivery.Run(ctx, deliveryConcurrency, consts.DeliveryMaxRetries, jobs)
+	slog.Info(fmt.Sprintf("Deferred notification delivery: %v", stats))
+
+	// games that failed are tried again on the next check
+	for key := range sent {
+		if err := db.ClearDigestQueueGame(key.channelID, key.game, now); err != nil {
+			slog.Error(fmt.Sprintf("Error clearing deferred %v changes of %v: %v", key.game, key.channelID, err))
+		}
+	}
+}
+
+func HandleServerSettings(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	if i.GuildID == "" {
+		RespondPrivate(s, i, "Server settings are only available in servers.")
+		return
+	}
+	g, err := db.GetGuildSettings(i.GuildID)
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error getting server settings: %v", err))
+		return
+	}
+
+	if val, exists := opts["timezone"]; exists {
+		loc, err := time.LoadLocation(strings.TrimSpace(val.StringValue()))
+		if err != nil || loc.String() == "Local" {
+			RespondPrivate(s, i, fmt.Sprintf("%q isn't a timezone; use a name like `Asia/Tokyo` or `America/New_York`.", val.StringValue()))
+			return
+		}
+		g.Timezone = loc.String()
+	}
+	if val, exists := opts["quiet_hours"]; exists {
+		input := strings.TrimSpace(val.StringValue())
+		if strings.EqualFold(input, "off") {
+			g.QuietStart, g.QuietEnd = 0, 0
+		} else {
+			start, end, found := strings.Cut(input, "-")
+			if !found {
+				RespondPrivate(s, i, "Give quiet hours as a range like `23:00-07:00`, or `off`.")
+				return
+			}
+			if g.QuietStart, err = util.ParseClock(start); err != nil {
+				RespondPrivate(s, i, err.Error())
+				return
+			}
+			if g.QuietEnd, err = util.ParseClock(end); err != nil {
+				RespondPrivate(s, i, err.Error())
+				return
+			}
+		}
+	}
+	if val, exists := opts["livestream_codes_bypass"]; exists {
+		g.LivestreamBypass = val.BoolValue()
+	}
+
+	if len(opts) > 0 {
+		if err = db.SetGuildSettings(i.GuildID, g); err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Error saving server settings: %v", err))
+			return
+		}
+	}
+
+	now := time.Now()
+	out := "**Server settings**\n"
+	out += fmt.Sprintf("**Timezone:** %v (it's %v there now)\n", g.Timezone, localTimePrint(now, guildLocation(g)))
+	out += fmt.Sprintf("**Quiet hours:** %v\n", quietHoursPrint(g))
+	if inQuietHours(g, now) {
+		out += fmt.Sprintf("-# Quiet hours are on; held back changes are announced <t:%v:R>.", schedule.QuietHoursEnd(g.QuietStart, g.QuietEnd, guildLocation(g), now).Unix())
+	}
+	RespondPrivate(s, i, strings.Trim(out, " \t\n"))
+}
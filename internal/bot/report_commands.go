@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// custom ID: code_report:<approve|reject>:<report ID>
+const codeReportPrefix = "code_report"
+
+// Where code reports go for review; set by the review_channel_id env var.
+// Reports are disabled if empty.
+var reviewChannelID string
+
+func codeReportPrint(r db.CodeReport) string {
+	livestream := ""
+	if r.Livestream {
+		livestream = " (livestream)"
+	}
+	return fmt.Sprintf(
+		"**Code report #%v** from <@%v>\n" +
+		"**Game:** %v\n" +
+		"**Code:** `%v`%v\n" +
+		"**Description:** %v",
+		r.ID, r.ReporterID, r.Game, r.Code, livestream, r.Description)
+}
+
+func HandleReportCode(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	if reviewChannelID == "" {
+		RespondPrivate(s, i, "Code reports aren't enabled for this bot.")
+		return
+	}
+
+	r := db.CodeReport{
+		Code: strings.ToUpper(strings.TrimSpace(opts["code"].StringValue())),
+		Game: opts["game"].StringValue(),
+		Description: strings.TrimSpace(opts["description"].StringValue()),
+		ReporterID: interactionAuthor(i.Interaction).ID,
+		Reported: time.Now(),
+	}
+	if val, exists := opts["livestream"]; exists {
+		r.Livestream = val.BoolValue()
+	}
+
+	// rate limit
+	count, err := db.CountUserCodeReports(r.ReporterID, time.Now().Add(-consts.CodeReportWindow))
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error checking your recent reports: %v", err))
+		return
+	}
+	if count >= consts.CodeReportLimit {
+		RespondPrivate(s, i, fmt.Sprintf("You can report up to %v codes per %v; please try again later.", consts.CodeReportLimit, util.FormatInterval(consts.CodeReportWindow)))
+		return
+	}
+
+	// duplicates
+	known, err := db.LookupCode(r.Code)
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error looking up code: %v", err))
+		return
+	}
+	for _, c := range known {
+		if c.Game == r.Game && c.Removed.IsZero() {
+			RespondPrivate(s, i, fmt.Sprintf("`%v` is already listed for %v. Thanks anyway!", r.Code, r.Game))
+			return
+		}
+	}
+	pending, err := db.HasPendingCodeReport(r.Code, r.Game)
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error checking reports: %v", err))
+		return
+	}
+	if pending {
+		RespondPrivate(s, i, fmt.Sprintf("`%v` has already been reported for %v and is awaiting review.", r.Code, r.Game))
+		return
+	}
+
+	r.ID, err = db.AddCodeReport(r)
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error saving report: %v", err))
+		return
+	}
+	_, err = s.ChannelMessageSendComplex(reviewChannelID, &discordgo.MessageSend{
+		Content: codeReportPrint(r),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: fmt.Sprintf("%v:approve:%v", codeReportPrefix, r.ID)},
+					discordgo.Button{Label: "Reject", Style: discordgo.DangerButton, CustomID: fmt.Sprintf("%v:reject:%v", codeReportPrefix, r.ID)},
+				},
+			},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("Could not post code report %v for review: %v", r.ID, err))
+		RespondPrivate(s, i, "Your report was saved, but I couldn't pass it on to moderators. It will be looked at later.")
+		return
+	}
+	RespondPrivate(s, i, fmt.Sprintf("Thanks! `%v` was sent to moderators for review.", r.Code))
+}
+
+// Add an approved report's code; returns the outcome for the reviewer.
+func approveCodeReport(s *discordgo.Session, r db.CodeReport) string {
+	err := db.AddCode(r.Code, r.Game, r.Description, r.Livestream, time.Now(), db.SourceCommunity)
+	if db.IsDuplicateErr(err) {
+		restored, err := db.RestoreCode(r.Code, r.Game, r.Description, r.Livestream, time.Now(), db.SourceCommunity)
+		if err != nil {
+			return fmt.Sprintf("Error restoring code: %v", err)
+		}
+		if !restored {
+			return "Code was already listed; nothing to announce."
+		}
+	} else if err != nil {
+		return fmt.Sprintf("Error adding code: %v", err)
+	}
+
+	go announceCodeChanges(s, map[string]*CodeChanges{
+		r.Game: {Added: [][]string{{r.Code, r.Description}}, Livestream: map[string]bool{r.Code: r.Livestream}},
+	})
+	return "Code added and announced."
+}
+
+// arg: <approve|reject>:<report ID>
+func HandleCodeReportClick(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	if i.Member == nil || i.Member.Permissions&discordgo.PermissionManageMessages == 0 {
+		RespondPrivate(s, i, "Only moderators can review code reports.")
+		return
+	}
+	action, idStr, _ := strings.Cut(arg, ":")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Bad code report button %v: %v", arg, err))
+		RespondPrivate(s, i, "This report button is broken; the report couldn't be found.")
+		return
+	}
+
+	r, err := db.GetCodeReport(id)
+	if err == sql.ErrNoRows {
+		RespondPrivate(s, i, "This report no longer exists.")
+		return
+	}
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error getting report: %v", err))
+		return
+	}
+
+	status := db.ReportRejected
+	if action == "approve" {
+		status = db.ReportApproved
+	}
+	reviewerID := interactionAuthor(i.Interaction).ID
+	updated, err := db.ReviewCodeReport(id, status, reviewerID)
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error saving review: %v", err))
+		return
+	}
+
+	outcome := ""
+	switch {
+	case !updated:
+		outcome = "This report was already reviewed."
+		r, _ = db.GetCodeReport(id)
+	case status == db.ReportApproved:
+		outcome = approveCodeReport(s, r)
+	}
+	if r.Status == db.ReportPending {
+		r.Status, r.ReviewerID = status, reviewerID
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content: strings.Trim(fmt.Sprintf("%v\n**%v** by <@%v>. %v", codeReportPrint(r), r.Status, r.ReviewerID, outcome), " \n"),
+			Components: []discordgo.MessageComponent{},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not update code report %v: %v", id, err))
+	}
+}
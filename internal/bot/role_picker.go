@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
+)
+
+// custom ID: role_picker:<role ID>
+const rolePickerPrefix = "role_picker"
+
+// "Genshin Impact" -> "genshin_impact"
+func gameOptionName(game string) string {
+	return strings.ReplaceAll(strings.ToLower(game), " ", "_")
+}
+
+func rolePickerOptions() []*discordgo.ApplicationCommandOption {
+	options := []*discordgo.ApplicationCommandOption{}
+	for _, game := range consts.Games {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Name: gameOptionName(game),
+			Description: fmt.Sprintf("Role members can pick to get pinged for %v codes.", game),
+			Type: discordgo.ApplicationCommandOptionRole,
+			Required: false,
+		})
+	}
+	return append(options, &discordgo.ApplicationCommandOption{
+		Name: "subscription_channel",
+		Description: "Subscribed channel whose announcements ping these roles. Default: this channel",
+		Type: discordgo.ApplicationCommandOptionChannel,
+		ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+		Required: false,
+	})
+}
+
+// Returns a user-facing reason if the bot can't hand out the role.
+func checkAssignableRole(s *discordgo.Session, guildID string, roleID string) error {
+	if roleID == guildID {
+		return fmt.Errorf("@everyone can't be handed out")
+	}
+
+	roles, err := s.GuildRoles(guildID)
+	if err != nil {
+		return fmt.Errorf("couldn't get server roles: %v", err)
+	}
+	me, err := s.GuildMember(guildID, s.State.User.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get my own roles: %v", err)
+	}
+
+	var perms int64
+	highest := 0
+	var target *discordgo.Role
+	for _, r := range roles {
+		if r.ID == roleID {
+			target = r
+		}
+		if r.ID == guildID || slices.Contains(me.Roles, r.ID) {
+			perms |= r.Permissions
+			highest = max(highest, r.Position)
+		}
+	}
+
+	if target == nil {
+		return fmt.Errorf("<@&%v> doesn't exist anymore", roleID)
+	}
+	if target.Managed {
+		return fmt.Errorf("<@&%v> is managed by an integration and can't be handed out", roleID)
+	}
+	if perms&(discordgo.PermissionManageRoles|discordgo.PermissionAdministrator) == 0 {
+		return fmt.Errorf("I need the **Manage Roles** permission to hand out <@&%v>", roleID)
+	}
+	if target.Position >= highest {
+		return fmt.Errorf("my highest role must be above <@&%v> in Server Settings > Roles to hand it out", roleID)
+	}
+	return nil
+}
+
+// Undo ping roles added for a role picker that couldn't be created.
+func removePickedPingRoles(channelID string, picks [][]string) {
+	for _, pick := range picks {
+		if _, err := db.RemovePingRole(channelID, pick[1], pick[0]); err != nil {
+			slog.Warn(fmt.Sprintf("Could not remove ping role %v for %v from %v: %v", pick[1], pick[0], channelID, err))
+		}
+	}
+}
+
+func HandleCreateRolePicker(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	if i.GuildID == "" {
+		RespondPrivate(s, i, "Role pickers can only be created in servers.")
+		return
+	}
+
+	subChannel := i.ChannelID
+	if val, exists := opts["subscription_channel"]; exists {
+		subChannel = val.ChannelValue(nil).ID
+	}
+	if _, err := db.GetSubscription(subChannel); err != nil {
+		if err == sql.ErrNoRows {
+			RespondPrivate(s, i, fmt.Sprintf("Please subscribe <#%v> first before running this command.", subChannel))
+			return
+		}
+
+		// unknown error
+		RespondPrivate(s, i, fmt.Sprintf("Error checking subscription for <#%v>: %v", subChannel, err))
+		return
+	}
+
+	// game -> role
+	picks := [][]string{}
+	problems := ""
+	roleGames := map[string]string{}
+	for _, game := range consts.Games {
+		val, exists := opts[gameOptionName(game)]
+		if !exists {
+			continue
+		}
+		roleID := val.RoleValue(nil, "").ID
+		// buttons are identified by their role
+		if other, exists := roleGames[roleID]; exists {
+			problems += fmt.Sprintf("- %v: <@&%v> is already picked for %v; give each game its own role\n", game, roleID, other)
+			continue
+		}
+		roleGames[roleID] = game
+		if err := checkAssignableRole(s, i.GuildID, roleID); err != nil {
+			problems += fmt.Sprintf("- %v: %v\n", game, err)
+			continue
+		}
+		picks = append(picks, []string{game, roleID})
+	}
+	if problems != "" {
+		RespondPrivate(s, i, "Can't create role picker:\n"+problems)
+		return
+	}
+	if len(picks) == 0 {
+		RespondPrivate(s, i, "Please specify a role for at least one game.")
+		return
+	}
+
+	// ping picked roles in the subscription for their game before posting,
+	// so a picker is never handed out for roles that won't be pinged
+	added := [][]string{}
+	for _, pick := range picks {
+		game, roleID := pick[0], pick[1]
+		err := db.AddPingRole(subChannel, roleID, game)
+		if db.IsDuplicateErr(err) {
+			continue
+		}
+		if err != nil {
+			removePickedPingRoles(subChannel, added)
+			RespondPrivate(s, i, fmt.Sprintf("Error adding <@&%v> as a ping role for %v: %v", roleID, game, err))
+			return
+		}
+		added = append(added, pick)
+	}
+
+	buttons := []discordgo.MessageComponent{}
+	for _, pick := range picks {
+		buttons = append(buttons, discordgo.Button{
+			Label: pick[0],
+			Style: discordgo.SecondaryButton,
+			CustomID: rolePickerPrefix + ":" + pick[1],
+		})
+	}
+	rows := []discordgo.MessageComponent{}
+	for _, row := range util.DownstackIntoSlices(buttons, 5) {
+		rows = append(rows, discordgo.ActionsRow{Components: row})
+	}
+
+	content := fmt.Sprintf(
+		"**Code notification roles**\n" +
+		"Pick the games you want to be pinged for when codes are announced in <#%v>. Click a game again to stop being pinged.", subChannel)
+	_, err := s.ChannelMessageSendComplex(i.ChannelID, &discordgo.MessageSend{
+		Content: content,
+		Components: rows,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		removePickedPingRoles(subChannel, added)
+		RespondPrivate(s, i, fmt.Sprintf("Error creating role picker: %v", err))
+		return
+	}
+
+	RespondPrivate(s, i, fmt.Sprintf("Successfully created role picker! Picked roles will be pinged for their game in <#%v>.", subChannel))
+}
+
+func HandleRolePickerClick(s *discordgo.Session, i *discordgo.InteractionCreate, roleID string) {
+	if i.Member == nil {
+		return
+	}
+	userID := i.Member.User.ID
+
+	var err error
+	var result string
+	if slices.Contains(i.Member.Roles, roleID) {
+		err = s.GuildMemberRoleRemove(i.GuildID, userID, roleID)
+		result = fmt.Sprintf("Removed <@&%v>; you won't be pinged for its codes anymore.", roleID)
+	} else {
+		err = s.GuildMemberRoleAdd(i.GuildID, userID, roleID)
+		result = fmt.Sprintf("Added <@&%v>; you'll be pinged when its codes are announced!", roleID)
+	}
+
+	if err != nil {
+		if strings.Contains(err.Error(), "HTTP 403") {
+			reason := checkAssignableRole(s, i.GuildID, roleID)
+			if reason == nil {
+				reason = err
+			}
+			RespondPrivate(s, i, fmt.Sprintf("I can't change <@&%v> for you: %v. Please let a server admin know.", roleID, reason))
+			return
+		}
+		RespondPrivate(s, i, fmt.Sprintf("Error changing <@&%v>: %v", roleID, err))
+		return
+	}
+	RespondPrivate(s, i, result)
+}
@@ -0,0 +1,221 @@
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hashicorp/go-set/v3"
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+)
+
+// custom ID: setup:<action>:<channel ID>
+const setupPanelPrefix = "setup"
+
+// max roles pickable at once in the panel
+const setupRoleLimit = 10
+
+// The /setup panel for a channel. note is shown above the settings, eg. to
+// report the outcome of the last change.
+func setupPanel(channelID string, note string) *discordgo.InteractionResponseData {
+	data := &discordgo.InteractionResponseData{
+		Flags: discordgo.MessageFlagsEphemeral,
+	}
+	if note != "" {
+		note += "\n\n"
+	}
+	id := func(action string) string {
+		return fmt.Sprintf("%v:%v:%v", setupPanelPrefix, action, channelID)
+	}
+
+	sub, err := db.GetSubscription(channelID)
+	if err == sql.ErrNoRows {
+		data.Content = note + fmt.Sprintf("<#%v> isn't subscribed to code notifications.", channelID)
+		data.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: "Subscribe", Style: discordgo.PrimaryButton, CustomID: id("subscribe")},
+					discordgo.Button{Label: "Create ticker here", Style: discordgo.SecondaryButton, CustomID: id("ticker")},
+					discordgo.Button{Label: "Refresh", Style: discordgo.SecondaryButton, CustomID: id("refresh")},
+				},
+			},
+		}
+		return data
+	}
+	if err != nil {
+		data.Content = note + fmt.Sprintf("Error checking subscription for <#%v>: %v", channelID, err)
+		return data
+	}
+	data.Content = note + getSubsPrint(sub)
+
+	// games
+	tracked, err := db.GetSubscriptionGames(channelID)
+	if err != nil {
+		data.Content += fmt.Sprintf("\n\nError getting games: %v", err)
+		return data
+	}
+	gameOptions := []discordgo.SelectMenuOption{}
+	for _, game := range consts.Games {
+		gameOptions = append(gameOptions, discordgo.SelectMenuOption{
+			Label: game,
+			Value: game,
+			Default: slices.Contains(tracked, game),
+		})
+	}
+
+	// roles pinged for all games; game-specific ones are left to /add_ping_role
+	roles, err := db.GetPingRoles(channelID)
+	if err != nil {
+		data.Content += fmt.Sprintf("\n\nError getting ping roles: %v", err)
+		return data
+	}
+	defaultRoles := []discordgo.SelectMenuDefaultValue{}
+	for _, r := range roles {
+		if r.Game == "" && len(defaultRoles) < setupRoleLimit {
+			defaultRoles = append(defaultRoles, discordgo.SelectMenuDefaultValue{ID: r.RoleID, Type: discordgo.SelectMenuDefaultValueRole})
+		}
+	}
+
+	toggleStyle := func(on bool) discordgo.ButtonStyle {
+		if on {
+			return discordgo.SuccessButton
+		}
+		return discordgo.SecondaryButton
+	}
+	zero := 0
+	data.Components = []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID: id("games"),
+					Placeholder: "Tracked games (none picked tracks all)",
+					MinValues: &zero,
+					MaxValues: len(gameOptions),
+					Options: gameOptions,
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					MenuType: discordgo.RoleSelectMenu,
+					CustomID: id("roles"),
+					Placeholder: "Roles to ping for all games",
+					MinValues: &zero,
+					MaxValues: setupRoleLimit,
+					DefaultValues: defaultRoles,
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Announce additions", Style: toggleStyle(sub.AnnounceAdds), CustomID: id("additions")},
+				discordgo.Button{Label: "Announce removals", Style: toggleStyle(sub.AnnounceRems), CustomID: id("removals")},
+				discordgo.Button{Label: "Create ticker here", Style: discordgo.SecondaryButton, CustomID: id("ticker")},
+				discordgo.Button{Label: "Refresh", Style: discordgo.SecondaryButton, CustomID: id("refresh")},
+				discordgo.Button{Label: "Unsubscribe", Style: discordgo.DangerButton, CustomID: id("unsubscribe")},
+			},
+		},
+	}
+	return data
+}
+
+func HandleSetup(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.GuildID == "" {
+		RespondPrivate(s, i, "Setup is only available in servers.")
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: setupPanel(i.ChannelID, ""),
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not show setup panel: %v", err))
+	}
+}
+
+// Apply a change made in the panel; returns the note to show with it.
+func applySetupAction(s *discordgo.Session, i *discordgo.InteractionCreate, action string, channelID string) string {
+	if action == "subscribe" {
+		target := db.DeliveryTarget{Mode: db.DeliverChannel, ThreadScope: db.ThreadPerGame}
+		err := db.CreateSubscription(channelID, i.GuildID, true, false, target, db.FormatText)
+		if err != nil && !db.IsDuplicateErr(err) {
+			return fmt.Sprintf("Error trying to create subscription: %v", err)
+		}
+		return "Subscribed!"
+	}
+	if action == "ticker" {
+		return postTicker(s, channelID, i.GuildID, []string{}, db.StyleEmbed)
+	}
+	if action == "refresh" {
+		return ""
+	}
+
+	sub, err := db.GetSubscription(channelID)
+	if err != nil {
+		return fmt.Sprintf("Error checking subscription: %v", err)
+	}
+
+	switch action {
+	case "unsubscribe":
+		if err = db.DeleteSubscription(channelID); err != nil {
+			return fmt.Sprintf("Error trying to unsubscribe: %v", err)
+		}
+		return "Unsubscribed."
+	case "additions", "removals":
+		adds, rems := sub.AnnounceAdds, sub.AnnounceRems
+		if action == "additions" {
+			adds = !adds
+		} else {
+			rems = !rems
+		}
+		if err = db.UpdateSubscription(channelID, adds, rems, sub.Target, sub.Format); err != nil {
+			return fmt.Sprintf("Error updating subscription: %v", err)
+		}
+		return "Updated announcements."
+	case "games":
+		if err = db.SetGameFilters(channelID, set.From(i.MessageComponentData().Values)); err != nil {
+			return fmt.Sprintf("Error setting games: %v", err)
+		}
+		return "Updated tracked games."
+	case "roles":
+		picked := i.MessageComponentData().Values
+		roles, err := db.GetPingRoles(channelID)
+		if err != nil {
+			return fmt.Sprintf("Error getting ping roles: %v", err)
+		}
+		for _, r := range roles {
+			if r.Game == "" && !slices.Contains(picked, r.RoleID) {
+				if err = db.RemoveAllGamesPingRole(channelID, r.RoleID); err != nil {
+					return fmt.Sprintf("Error removing ping role <@&%v>: %v", r.RoleID, err)
+				}
+			}
+		}
+		for _, roleID := range picked {
+			if err = db.AddPingRole(channelID, roleID, ""); err != nil && !db.IsDuplicateErr(err) {
+				return fmt.Sprintf("Error adding ping role <@&%v>: %v", roleID, err)
+			}
+		}
+		return "Updated roles to ping."
+	}
+	slog.Warn(fmt.Sprintf("Unknown setup action %v", action))
+	return ""
+}
+
+// arg: <action>:<channel ID>
+func HandleSetupClick(s *discordgo.Session, i *discordgo.InteractionCreate, arg string) {
+	action, channelID, _ := strings.Cut(arg, ":")
+	note := applySetupAction(s, i, action, channelID)
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: setupPanel(channelID, note),
+	})
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not update setup panel: %v", err))
+	}
+}
@@ -8,12 +8,33 @@ import (
 	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
 )
 
+func pingRoleScope(game string) string {
+	if game == "" {
+		return "all games"
+	}
+	return game + " only"
+}
+
+func deliveryPrint(target db.DeliveryTarget) string {
+	switch target.Mode {
+	case db.DeliverForum:
+		return fmt.Sprintf("posts in <#%v>, new post per %v", target.ForumID, target.ThreadScope)
+	case db.DeliverThread:
+		return fmt.Sprintf("threads in this channel, new thread per %v", target.ThreadScope)
+	default:
+		return "messages in this channel"
+	}
+}
+
 func getSubsPrint(sub *db.Subscription) string {
 	const TEMPLATE string = (
 		"__**<#%v>**__\n"+
 		"**Active:** %v\n"+
 		"**Announce additions:** %v\n"+
 		"**Announce removals:** %v\n"+
+		"**Delivery:** %v\n"+
+		"**Format:** %v\n"+
+		"**Digest:** %v\n"+
 		"**Tracked games:**\n"+
 		"%v" + 
 		"**Roles to ping:**\n"+
@@ -42,9 +63,9 @@ func getSubsPrint(sub *db.Subscription) string {
 		return fmt.Sprintf("Error getting ping roles for <#%v>: %v", sub.ChannelID, err)
 	}
 	for _, r := range roles {
-		roleList += fmt.Sprintf("- <@&%v>\n", r)
+		roleList += fmt.Sprintf("- <@&%v> (%v)\n", r.RoleID, pingRoleScope(r.Game))
 	}
 	roleList = strings.TrimLeft(roleList, " \t\n")
 
-	return strings.Trim(fmt.Sprintf(TEMPLATE, sub.ChannelID, sub.Active, sub.AnnounceAdds, sub.AnnounceRems, gameList, roleList), " \t\n")
+	return strings.Trim(fmt.Sprintf(TEMPLATE, sub.ChannelID, sub.Active, sub.AnnounceAdds, sub.AnnounceRems, deliveryPrint(sub.Target), sub.Format, digestPrint(sub.Digest), gameList, roleList), " \t\n")
 }
@@ -21,11 +21,42 @@ func HandleSubscribe(s *discordgo.Session, i *discordgo.InteractionCreate, opts
 		notifyRem = val.BoolValue()
 	}
 
-	err := db.CreateSubscription(i.ChannelID, i.GuildID, notifyAdd, notifyRem)
+	target := db.DeliveryTarget{
+		Mode: db.DeliverChannel,
+		ThreadScope: db.ThreadPerGame,
+	}
+	if val, exists := opts["delivery"]; exists {
+		target.Mode = db.DeliveryMode(val.StringValue())
+	}
+	if val, exists := opts["new_thread_per"]; exists {
+		target.ThreadScope = db.ThreadScope(val.StringValue())
+	}
+	format := db.FormatText
+	if val, exists := opts["format"]; exists {
+		format = db.NotificationFormat(val.StringValue())
+	}
+	if target.Mode == db.DeliverForum {
+		val, exists := opts["forum"]
+		if !exists {
+			RespondPrivate(s, i, "Please specify a `forum` channel to post in for forum delivery.")
+			return
+		}
+		target.ForumID = val.ChannelValue(nil).ID
+	}
+
+	err := db.CreateSubscription(i.ChannelID, i.GuildID, notifyAdd, notifyRem, target, format)
 	if err != nil {
 		// duplicate? update instead
 		if db.IsDuplicateErr(err) {
-			err = db.UpdateSubscription(i.ChannelID, notifyAdd, notifyRem)
+			// threads of the old target shouldn't be replied to anymore
+			if old, err := db.GetSubscription(i.ChannelID); err == nil && old.Target != target {
+				if err = db.ClearSubscriptionThreads(i.ChannelID); err != nil {
+					RespondPrivate(s, i, fmt.Sprintf("Error clearing old threads for <#%v>: %v", i.ChannelID, err))
+					return
+				}
+			}
+
+			err = db.UpdateSubscription(i.ChannelID, notifyAdd, notifyRem, target, format)
 			if err != nil {
 				RespondPrivate(s, i, fmt.Sprintf("Error updating existing subscription for <#%v>: %v", i.ChannelID, err))
 				return
@@ -79,21 +110,13 @@ func HandleFilterGames(s *discordgo.Session, i *discordgo.InteractionCreate, opt
 		return
 	} 
 
-	games := set.New[string](4)
-	if val, exists := opts["game_1"]; exists {
-		games.Insert(val.StringValue())
-	}
-	if val, exists := opts["game_2"]; exists {
-		games.Insert(val.StringValue())
-	}
-	if val, exists := opts["game_3"]; exists {
-		games.Insert(val.StringValue())
-	}
-	if val, exists := opts["game_4"]; exists {
-		games.Insert(val.StringValue())
+	games, err := optionGames(opts)
+	if err != nil {
+		RespondPrivate(s, i, err.Error())
+		return
 	}
 
-	err := db.SetGameFilters(i.ChannelID, games)
+	err = db.SetGameFilters(i.ChannelID, set.From(games))
 	if err != nil {
 		RespondPrivate(s, i, fmt.Sprintf("Error setting game filters for <#%v>: %v", i.ChannelID, err))
 		return
@@ -115,12 +138,17 @@ func HandleAddPingRole(s *discordgo.Session, i *discordgo.InteractionCreate, opt
 	} 
 
 	roleID := opts["role"].RoleValue(nil, "").ID
-	err := db.AddPingRole(i.ChannelID, roleID)
+	game := ""
+	if val, exists := opts["game"]; exists {
+		game = val.StringValue()
+	}
+
+	err := db.AddPingRole(i.ChannelID, roleID, game)
 	if err != nil && !db.IsDuplicateErr(err) {
 		RespondPrivate(s, i, fmt.Sprintf("Error adding ping role for <@&%v> in <#%v>: %v", roleID, i.ChannelID, err))
 		return
 	}
-	RespondPrivate(s, i, fmt.Sprintf("Successfully added ping role for <@&%v> in <#%v>!", roleID, i.ChannelID))
+	RespondPrivate(s, i, fmt.Sprintf("Successfully added ping role for <@&%v> in <#%v> (%v)!", roleID, i.ChannelID, pingRoleScope(game)))
 }
 
 func HandleRemovePingRole(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
@@ -137,12 +165,33 @@ func HandleRemovePingRole(s *discordgo.Session, i *discordgo.InteractionCreate,
 	} 
 
 	roleID := opts["role"].RoleValue(nil, "").ID
-	err := db.RemovePingRole(i.ChannelID, roleID)
+	game := ""
+	if val, exists := opts["game"]; exists {
+		game = val.StringValue()
+	}
+
+	removed, err := db.RemovePingRole(i.ChannelID, roleID, game)
 	if err != nil  {
 		RespondPrivate(s, i, fmt.Sprintf("Error removing ping role <@&%v> from <#%v>: %v", roleID, i.ChannelID, err))
 		return
 	}
-	RespondPrivate(s, i, fmt.Sprintf("Successfully removed ping role <@&%v> from <#%v>!", roleID, i.ChannelID))
+	if game != "" {
+		// a role pinging for all games keeps pinging for the others
+		narrowed, err := db.ExcludePingRoleGame(i.ChannelID, roleID, game)
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Error removing ping role <@&%v> from <#%v>: %v", roleID, i.ChannelID, err))
+			return
+		}
+		if narrowed {
+			RespondPrivate(s, i, fmt.Sprintf("<@&%v> pinged for all games in <#%v>; it now pings for every game except %v.", roleID, i.ChannelID, game))
+			return
+		}
+	}
+	if !removed {
+		RespondPrivate(s, i, fmt.Sprintf("<@&%v> isn't a ping role in <#%v> (%v).", roleID, i.ChannelID, pingRoleScope(game)))
+		return
+	}
+	RespondPrivate(s, i, fmt.Sprintf("Successfully removed ping role <@&%v> from <#%v> (%v)!", roleID, i.ChannelID, pingRoleScope(game)))
 }
 
 func HandleCheckSubscription(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
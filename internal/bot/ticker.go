@@ -1,13 +1,20 @@
 package bot
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/internal/delivery"
 	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
 	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
 )
@@ -34,9 +41,9 @@ func appendCodeFields(fields []*discordgo.MessageEmbedField, codes [][]string, g
 func tickerEmbeds(game string, willRefresh bool) []*discordgo.MessageEmbed {
 	fieldLists := [][]*discordgo.MessageEmbedField{}
 
-	unrecentCodes := db.GetCodes(game, db.Unrecent, false)
-	recentCodes := db.GetCodes(game, db.Recent, false)
-	livestreamCodes := db.GetCodes(game, db.All, true)
+	unrecentCodes := tickerCodes(game, db.Unrecent, false)
+	recentCodes := tickerCodes(game, db.Recent, false)
+	livestreamCodes := tickerCodes(game, db.All, true)
 	numCodes := len(unrecentCodes)+len(recentCodes)+len(livestreamCodes)
 
 	// code embeds
@@ -75,30 +82,166 @@ func tickerEmbeds(game string, willRefresh bool) []*discordgo.MessageEmbed {
 	}
 	footerFields = append(footerFields, redeemField)
 
+	footerFields = append(footerFields,
+		&discordgo.MessageEmbedField{
+			Value: tickerFreshness(game, willRefresh, false),
+		},
+	)
+
+	return gameEmbeds(game, game, fieldLists, footerFields)
+}
+
+// Subtext on when a game's codes were checked and its source updated.
+// Self-updating tickers state how often they're checked rather than when,
+// so they only need editing when their codes or source change; scrapes are
+// rescheduled every time, so the next check would edit them on each one.
+// Message content should suppress link previews; embeds don't need to.
+func tickerFreshness(game string, willRefresh bool, suppressPreview bool) string {
 	checkTime, updateTime, err := db.GetScrapeTimes(game)
 	if err != nil {
 		log.Fatalf("Error getting update time for %v: %v", game, err)
 	}
-	timeField := fmt.Sprintf("-# Checked <t:%v:R>; [source](%v) updated <t:%v:R>.", checkTime.Unix(), consts.ArticleURL[game], updateTime.Unix())
+	source := consts.ArticleURL[game]
+	if suppressPreview {
+		source = "<" + source + ">"
+	}
 	if willRefresh {
-		refreshTime := checkTime.Add(consts.UpdateInterval)
-		timeField += fmt.Sprintf("\n-# Refreshing <t:%v:R>.", refreshTime.Unix())
+		return fmt.Sprintf("-# [Source](%v) updated <t:%v:R>; checked at least every %v.", source, updateTime.Unix(), util.FormatInterval(consts.MaxScrapeInterval))
 	}
+	return fmt.Sprintf("-# Checked <t:%v:R>; [source](%v) updated <t:%v:R>.", checkTime.Unix(), source, updateTime.Unix())
+}
 
-	footerFields = append(footerFields,
-		&discordgo.MessageEmbedField{
-			Value: timeField,
+// Codes listed under an optional heading in a compact ticker.
+type tickerSection struct {
+	heading string
+	codes [][]string
+}
+
+// A single embed listing a game's codes in its description. Descriptions
+// are left out when withDescriptions is false to save space. The
+// description is kept within limit characters.
+func compactTickerEmbed(game string, willRefresh bool, withDescriptions bool, limit int) *discordgo.MessageEmbed {
+	sections := []tickerSection{
+		{"", tickerCodes(game, db.All, false)},
+		{"**Livestream codes (use ASAP!)**", tickerCodes(game, db.All, true)},
+	}
+	tail := tickerFreshness(game, willRefresh, false)
+	if redeem, exists := consts.RedeemURL[game]; exists {
+		tail = fmt.Sprintf("**[Redemption page](%v)**\n", redeem) + tail
+	}
+	return compactEmbed(game, sections, tail, withDescriptions, limit)
+}
+
+func compactEmbed(game string, sections []tickerSection, tail string, withDescriptions bool, limit int) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Color: color[game],
+		Title: game,
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: image[game],
 		},
-	)
+		Description: compactCodeList(game, sections, withDescriptions, limit - utf8.RuneCountInString(tail)) + tail,
+	}
+}
+
+// List codes one per line, or on a single line when withDescriptions is
+// false. Codes past limit characters are cut off and marked with "…".
+func compactCodeList(game string, sections []tickerSection, withDescriptions bool, limit int) string {
+	const more = "\n…\n"
+	limit -= utf8.RuneCountInString(more)
+	desc := ""
+	cut := false
+	add := func(text string) {
+		if cut || utf8.RuneCountInString(desc) + utf8.RuneCountInString(text) > limit {
+			cut = true
+			return
+		}
+		desc += text
+	}
+
+	for _, section := range sections {
+		if len(section.codes) == 0 {
+			continue
+		}
+		if section.heading != "" {
+			add(section.heading + "\n")
+		}
+		for i, code := range section.codes {
+			switch {
+			case !withDescriptions && i < len(section.codes)-1:
+				add("`" + code[0] + "` · ")
+			case !withDescriptions:
+				add("`" + code[0] + "`\n")
+			default:
+				if url := util.CodeRedeemURL(code[0], game); url != nil {
+					add(fmt.Sprintf("[`%v`](%v) - %v\n", code[0], *url, code[1]))
+				} else {
+					add(fmt.Sprintf("`%v` - %v\n", code[0], code[1]))
+				}
+			}
+		}
+	}
+	if cut {
+		return strings.TrimRight(desc, " ·\n") + more
+	}
+	if desc == "" {
+		return "No codes reported active.\n"
+	}
+	return desc
+}
 
-	// assemble downstacked
+func fitsMessage(embeds []*discordgo.MessageEmbed) bool {
+	chars := 0
+	for _, e := range embeds {
+		chars += embedLength(e)
+	}
+	return len(embeds) <= consts.MessageEmbedLimit && chars <= consts.MessageEmbedCharLimit
+}
+
+// Embeds for a ticker showing one or more games, with a section per game.
+// Falls back to a compact layout when the full one doesn't fit a message.
+func multiTickerEmbeds(games []string, willRefresh bool) []*discordgo.MessageEmbed {
+	full := []*discordgo.MessageEmbed{}
+	for _, game := range games {
+		full = append(full, tickerEmbeds(game, willRefresh)...)
+	}
+	if fitsMessage(full) {
+		return full
+	}
+
+	compact := []*discordgo.MessageEmbed{}
+	for _, game := range games {
+		compact = append(compact, compactTickerEmbed(game, willRefresh, true, consts.EmbedDescriptionLimit))
+	}
+	if fitsMessage(compact) {
+		return compact
+	}
+
+	// split what a message holds between the games, cutting off codes that
+	// don't fit
+	slog.Debug("Ticker too large for compact layout; leaving out descriptions", "games", games)
+	codesOnly := []*discordgo.MessageEmbed{}
+	for _, game := range games {
+		codesOnly = append(codesOnly, compactTickerEmbed(game, willRefresh, false, codesOnlyLimit(game, len(games))))
+	}
+	return codesOnly
+}
+
+// Description length each game's codes-only embed gets so that count of
+// them fit one message.
+func codesOnlyLimit(game string, count int) int {
+	return min(consts.MessageEmbedCharLimit/count - utf8.RuneCountInString(game), consts.EmbedDescriptionLimit)
+}
+
+// Assemble field lists into embeds styled for a game: game colour, with the
+// first embed titled and thumbnailed, and a footer embed at the end.
+func gameEmbeds(game string, title string, fieldLists [][]*discordgo.MessageEmbedField, footerFields []*discordgo.MessageEmbedField) []*discordgo.MessageEmbed {
 	downstacked := []*discordgo.MessageEmbed{}
 	for i, curFields := range fieldLists {
 		curEmbed := discordgo.MessageEmbed{ Color: color[game], }
 		if i == 0 {
 			curEmbed = discordgo.MessageEmbed{
 				Color: color[game],
-				Title: game,
+				Title: title,
 				Thumbnail: &discordgo.MessageEmbedThumbnail{
 					URL: image[game],
 				},
@@ -112,34 +255,247 @@ func tickerEmbeds(game string, willRefresh bool) []*discordgo.MessageEmbed {
 	return append(downstacked, &footerEmbed)
 }
 
-func UpdateEmbedTickersGame(s *discordgo.Session, game string) {
-	tickers, err := db.GetGameTickers(game)
+// A game's active codes, with codes users report expired marked as such.
+func tickerCodes(game string, recency db.CodeRecencyOption, livestream bool) [][]string {
+	codes := db.GetCodes(game, recency, livestream)
+	flagged, err := db.GetFlaggedCodes(game)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not get codes reported expired for %v: %v", game, err))
+		return codes
+	}
+	for _, code := range codes {
+		if flagged[code[0]] {
+			code[1] = "⚠️ (reportedly expired) " + code[1]
+		}
+	}
+	return codes
+}
+
+// Codes of a game shown on text tickers: regular codes, then livestream codes.
+func textTickerSections(game string) [][][]string {
+	return [][][]string{
+		tickerCodes(game, db.All, false),
+		tickerCodes(game, db.All, true),
+	}
+}
+
+// Compact markdown list of a game's codes.
+func textTickerSection(game string, willRefresh bool) string {
+	sections := textTickerSections(game)
+	out := fmt.Sprintf("### %v\n", game)
+	if len(sections[0])+len(sections[1]) == 0 {
+		out += "No codes reported active.\n"
+	}
+	if len(sections[0]) > 0 {
+		out += util.CodeListing(sections[0], &game) + "\n"
+	}
+	if len(sections[1]) > 0 {
+		out += "**Livestream codes (use ASAP!)**\n"
+		out += util.CodeListing(sections[1], &game) + "\n"
+	}
+	if link, exists := consts.RedeemURL[game]; exists {
+		out += fmt.Sprintf("[Redemption page](<%v>)\n", link)
+	}
+	return out + tickerFreshness(game, willRefresh, true)
+}
+
+// Monospace table of a game's codes.
+func tableTickerSection(game string, willRefresh bool) string {
+	const descWidth = 36
+	sections := textTickerSections(game)
+
+	rows := [][]string{}
+	for i, section := range sections {
+		for _, code := range section {
+			desc := []rune(code[1])
+			if len(desc) > descWidth {
+				desc = append(desc[:descWidth-1], '…')
+			}
+			if i == 1 {
+				desc = append([]rune("(live) "), desc...)
+			}
+			rows = append(rows, []string{code[0], string(desc)})
+		}
+	}
+
+	codeWidth := len("Code")
+	for _, row := range rows {
+		codeWidth = max(codeWidth, utf8.RuneCountInString(row[0]))
+	}
+
+	out := fmt.Sprintf("### %v\n```\n", game)
+	out += fmt.Sprintf("%-*v | %v\n", codeWidth, "Code", "Reward")
+	out += strings.Repeat("-", codeWidth) + "-+-" + strings.Repeat("-", descWidth) + "\n"
+	for _, row := range rows {
+		out += fmt.Sprintf("%-*v | %v\n", codeWidth, row[0], row[1])
+	}
+	if len(rows) == 0 {
+		out += "No codes reported active.\n"
+	}
+	out += "```\n"
+	if link, exists := consts.RedeemURL[game]; exists {
+		out += fmt.Sprintf("[Redemption page](<%v>)\n", link)
+	}
+	return out + tickerFreshness(game, willRefresh, true)
+}
+
+// What a ticker message displays: content for text styles, embeds otherwise.
+type tickerRender struct {
+	Content string
+	Embeds []*discordgo.MessageEmbed
+	Components []discordgo.MessageComponent
+}
+
+// Identifies what's displayed, to tell whether a ticker needs editing.
+func (r tickerRender) Hash() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Fatalf("Error hashing ticker: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func renderTicker(games []string, style db.TickerStyle, willRefresh bool) tickerRender {
+	var section func(string, bool) string
+	switch style {
+	case db.StyleText:
+		section = textTickerSection
+	case db.StyleTable:
+		section = tableTickerSection
+	default:
+		return tickerRender{Embeds: multiTickerEmbeds(games, willRefresh), Components: expiryButtons(games)}
+	}
+
+	sections := []string{}
+	for _, game := range games {
+		sections = append(sections, section(game, willRefresh))
+	}
+	content := strings.Join(sections, "\n")
+	if pages := util.Paginate(content, consts.MessageContentLimit); len(pages) > 1 {
+		// a ticker is a single message; cut off what doesn't fit
+		slog.Debug("Ticker content too long; truncating", "games", games, "style", style)
+		content = strings.TrimSuffix(pages[0], fmt.Sprintf("\n-# Page 1/%d", len(pages))) + "\n-# …more codes didn't fit; try fewer games per ticker."
+	}
+	return tickerRender{Content: content, Embeds: []*discordgo.MessageEmbed{}, Components: expiryButtons(games)}
+}
+
+func UpdateTickers(ctx context.Context, s *discordgo.Session) {
+	tickers, err := db.GetTickers()
 	if err != nil {
 		log.Fatalf("Error getting embeds to update: %v", err)
 	}
 
-	embeds := tickerEmbeds(game, true)	
+	// tickers showing the same games in the same style look the same
+	rendered := map[string]tickerRender{}
+	hashes := map[string]string{}
+	skipped := 0
+
+	jobs := []delivery.Job{}
+	for _, t := range tickers {
+		key := string(t.Style) + ":" + strings.Join(t.Games, ",")
+		render, exists := rendered[key]
+		if !exists {
+			render = renderTicker(t.ShownGames(), t.Style, true)
+			rendered[key] = render
+			hashes[key] = render.Hash()
+		}
+		if t.ContentHash == hashes[key] || t.Status == db.TickerMissing {
+			// unchanged, or nothing to edit until it's repaired
+			skipped++
+			continue
+		}
 
-	for _, msg := range tickers {
-		channelID, messageID := msg[0], msg[1]
 		edit := discordgo.MessageEdit{
-			Channel: channelID,
-			ID: messageID,
-			Content: new(string),
-			Embeds: &embeds,
+			Channel: t.ChannelID,
+			ID: t.MessageID,
+			Content: &render.Content,
+			Embeds: &render.Embeds,
+			Components: &render.Components,
 		}
-		if _, err = s.ChannelMessageEditComplex(&edit); err != nil {
-			if strings.Contains(err.Error(), "HTTP 404") {
-				// message no longer exists -- delete from db
-				err := db.RemoveTicker(messageID)
-				if err != nil {
-					slog.Error(fmt.Sprintf("Error removing 404'd ticker from db during update: %v", err))
+		hash := hashes[key]
+		jobs = append(jobs, delivery.Job{
+			Route: t.ChannelID,
+			Do: func(opts ...discordgo.RequestOption) error {
+				_, err := s.ChannelMessageEditComplex(&edit, opts...)
+				return err
+			},
+			Done: func(err error) {
+				if err == nil {
+					if err = db.MarkTickerUpdated(t.MessageID, hash); err != nil {
+						slog.Error(fmt.Sprintf("Error saving content hash of ticker %v: %v", t.MessageID, err))
+					}
+					return
 				}
-			} else if strings.Contains(err.Error(), "HTTP 403") {
-				slog.Warn(fmt.Sprintf("HTTP Forbidden 403 while editing ticker %v: %v", messageID, err))
-			} else {
-				log.Fatalf("Error updating ticker: %v", err)
-			}
+				handleTickerError(s, t, err)
+			},
+		})
+	}
+	slog.Info(fmt.Sprintf("Skipped editing %v of %v tickers that are unchanged or missing", skipped, len(tickers)))
+
+	stats := delivery.Run(ctx, deliveryConcurrency, consts.DeliveryMaxRetries, jobs)
+	slog.Info(fmt.Sprintf("Ticker delivery: %v", stats))
+}
+
+// What's wrong with a ticker given the error from accessing it. The ticker
+// should be removed from the DB if its channel is gone.
+func tickerProblem(err error) (status db.TickerStatus, channelGone bool) {
+	switch {
+	case delivery.ErrorCode(err) == discordgo.ErrCodeUnknownChannel:
+		return db.TickerMissing, true
+	case delivery.StatusCode(err) == http.StatusNotFound:
+		return db.TickerMissing, false
+	case delivery.StatusCode(err) == http.StatusForbidden:
+		return db.TickerForbidden, false
+	}
+	return "", false
+}
+
+// Record a failed ticker update, telling the server owner if it keeps failing.
+func handleTickerError(s *discordgo.Session, t db.Ticker, err error) {
+	status, channelGone := tickerProblem(err)
+	if channelGone {
+		slog.Info(fmt.Sprintf("Channel of ticker %v no longer exists; removing", t.MessageID))
+		if err := db.RemoveTicker(t.MessageID); err != nil {
+			slog.Error(fmt.Sprintf("Error removing ticker of deleted channel: %v", err))
 		}
+		return
+	}
+	if status == "" {
+		slog.Error(fmt.Sprintf("Error updating ticker %v: %v", t.MessageID, err))
+		return
+	}
+
+	slog.Warn(fmt.Sprintf("Ticker %v is %v: %v", t.MessageID, status, err))
+	failures, err := db.MarkTickerFailed(t.MessageID, status)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Error recording failure of ticker %v: %v", t.MessageID, err))
+		return
+	}
+	if status == db.TickerForbidden && failures == consts.TickerFailureAlertThreshold {
+		alertTickerFailing(s, t)
+	}
+}
+
+// DM the server owner about a ticker that can't be updated.
+func alertTickerFailing(s *discordgo.Session, t db.Ticker) {
+	guild, err := s.Guild(t.GuildID)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not get guild %v to alert of failing ticker: %v", t.GuildID, err))
+		return
+	}
+	dm, err := s.UserChannelCreate(guild.OwnerID)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not DM owner of %v about failing ticker: %v", t.GuildID, err))
+		return
+	}
+
+	url := fmt.Sprintf(consts.MessageLinkTemplate, t.GuildID, t.ChannelID, t.MessageID)
+	msg := fmt.Sprintf(
+		"A code ticker in **%v** hasn't been updated for the last %v tries because I'm not allowed to edit it: %v\n" +
+		"Please make sure I can view <#%v> and read its message history, or run `/repair_tickers` there to check on it.",
+		guild.Name, consts.TickerFailureAlertThreshold, url, t.ChannelID)
+	if _, err = s.ChannelMessageSend(dm.ID, msg); err != nil {
+		slog.Warn(fmt.Sprintf("Could not DM owner of %v about failing ticker: %v", t.GuildID, err))
 	}
 }
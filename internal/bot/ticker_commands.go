@@ -1,14 +1,20 @@
 package bot
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"net/url"
+	"log/slog"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/internal/delivery"
 	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
 )
 
 var color map[string]int = map[string]int{
@@ -25,65 +31,95 @@ var image map[string]string = map[string]string{
 	"Zenless Zone Zero": "https://fastcdn.hoyoverse.com/static-resource-v2/2023/11/02/bf82c4f8573eb6292f338a3ec41c1615_6171503094506184079.png",
 }
 
+func tickerGamesPrint(games []string) string {
+	if len(games) == 0 {
+		return "all games"
+	}
+	return strings.Join(games, ", ")
+}
+
 func HandleCreateTicker(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
 	guildID := i.GuildID
-	game := opts["game"].StringValue()
-	embeds := tickerEmbeds(game, true)
-
-	message, err := s.ChannelMessageSendEmbeds(i.ChannelID, embeds)
+	games, err := optionGames(opts)
 	if err != nil {
-		RespondPrivate(s, i, fmt.Sprintf("Error creating ticker: %v", err))
+		RespondPrivate(s, i, err.Error())
 		return
 	}
-
-	messageID := message.ID
-	err = db.AddTicker(messageID, game, i.ChannelID, guildID)
-	if err != nil {
-		RespondPrivate(s, i, fmt.Sprintf(
-			"Created ticker but can't save for updating: %v\n" +
-			"This ticker will not update; please delete it and try again.", err))
-		return
+	style := db.StyleEmbed
+	if val, exists := opts["style"]; exists {
+		style = db.TickerStyle(val.StringValue())
 	}
-	RespondPrivate(s, i, fmt.Sprintf("Successfully created ticker in <#%v> for %v!", i.ChannelID, game))
+	RespondPrivate(s, i, postTicker(s, i.ChannelID, guildID, games, style))
 }
 
-func HandleDeleteTicker(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
-	messageURL := opts["message_link"].StringValue()
+// Post a new ticker and start tracking it; returns the outcome for the user.
+func postTicker(s *discordgo.Session, channelID string, guildID string, games []string, style db.TickerStyle) string {
+	render := renderTicker(db.Ticker{Games: games}.ShownGames(), style, true)
 
-	url, err := url.Parse(messageURL)
+	message, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: render.Content,
+		Embeds: render.Embeds,
+		Components: render.Components,
+	})
 	if err != nil {
-		RespondPrivate(s, i, fmt.Sprintf("Error parsing message link: %v", err))
-		return
+		return fmt.Sprintf("Error creating ticker: %v", err)
 	}
 
-	pTrim := strings.Trim(url.Path, "/")
-	path := strings.Split(pTrim, "/")
-	if len(path) != 4 {
-		RespondPrivate(s, i, fmt.Sprintf("Bad URL: path length is %v, expected 4.", len(path)))
-		return
+	messageID := message.ID
+	err = db.AddTicker(messageID, games, style, channelID, guildID)
+	if err != nil {
+		return fmt.Sprintf(
+			"Created ticker but can't save for updating: %v\n" +
+			"This ticker will not update; please delete it and try again.", err)
 	}
+	return fmt.Sprintf("Successfully created ticker in <#%v> for %v!", channelID, tickerGamesPrint(games))
+}
 
-	channelID := path[2]
-	messageID := path[3]
+// Find the ticker a command is about: the message a context-menu command
+// was used on, or the message link or ID given as message_link. The ticker
+// must be in the interaction's server.
+func commandTicker(i *discordgo.InteractionCreate, opts CmdOptMap) (db.Ticker, error) {
+	link := util.MessageLink{GuildID: i.GuildID, ChannelID: i.ChannelID}
+	if data := i.ApplicationCommandData(); data.TargetID != "" {
+		link.MessageID = data.TargetID
+	} else {
+		parsed, err := util.ParseMessageLink(opts["message_link"].StringValue())
+		if err != nil {
+			return db.Ticker{}, fmt.Errorf("Bad message link: %v", err)
+		}
+		link = parsed
+	}
 
-	// message deletion abuse prevention
-	msg, err := s.ChannelMessage(channelID, messageID)
+	if link.GuildID != "" && link.GuildID != i.GuildID {
+		return db.Ticker{}, errors.New("That message is in another server.")
+	}
+	t, err := db.GetTicker(link.MessageID)
+	if err == sql.ErrNoRows || (err == nil && t.GuildID != i.GuildID) ||
+		(err == nil && link.ChannelID != "" && link.ChannelID != t.ChannelID) {
+		return db.Ticker{}, errors.New("That message isn't a ticker in this server.")
+	}
 	if err != nil {
-		RespondPrivate(s, i, fmt.Sprintf("Couldn't fetch message: %v", err))
-		return
+		return db.Ticker{}, fmt.Errorf("Error getting ticker: %v", err)
 	}
-	if msg.Author.String() != s.State.User.String() {
-		RespondPrivate(s, i, "Can't delete message as I didn't make it!")
+	return t, nil
+}
+
+func HandleDeleteTicker(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	t, err := commandTicker(i, opts)
+	if err != nil {
+		RespondPrivate(s, i, err.Error())
 		return
 	}
 
-	if err = s.ChannelMessageDelete(channelID, messageID); err != nil {
-		RespondPrivate(s, i, fmt.Sprintf("Error deleting message %v: %v", messageID, err))
+	// stop tracking it even if the message is already gone
+	err = s.ChannelMessageDelete(t.ChannelID, t.MessageID)
+	if err != nil && delivery.StatusCode(err) != http.StatusNotFound {
+		RespondPrivate(s, i, fmt.Sprintf("Error deleting message %v: %v", t.MessageID, err))
 		return
 	}
 
 	// remove message from DB
-	err = db.RemoveTicker(messageID)
+	err = db.RemoveTicker(t.MessageID)
 	if err != nil {
 		RespondPrivate(s, i, fmt.Sprintf("Error removing ticker from tracking: %v", err))
 		return
@@ -100,11 +136,275 @@ func HandleGetTickers(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	out := fmt.Sprintf("**Tickers in server ID %v**\n", i.GuildID)
 	for _, t := range tickers {
 		url := fmt.Sprintf(consts.MessageLinkTemplate, i.GuildID, t.ChannelID, t.MessageID)
-		out += fmt.Sprintf("- %v (%v)\n", url, t.Game)
+		out += fmt.Sprintf("- %v (%v, %v)%v\n", url, tickerGamesPrint(t.Games), t.Style, tickerStatusPrint(t))
 	}
+
+	out += "\n**Next checks**\n" + nextChecksPrint()
 	RespondPrivate(s, i, strings.Trim(out, " \t\n"))
 }
 
+// When each game is scraped next, and which are polled faster for a livestream.
+func nextChecksPrint() string {
+	out := ""
+	now := time.Now()
+	for _, game := range consts.Games {
+		out += fmt.Sprintf("- %v: <t:%v:R>", game, scrapeSchedule.Next(game).Unix())
+		if scrapeSchedule.InLivestream(game, now) {
+			out += " (livestream)"
+		}
+		out += "\n"
+	}
+	return out
+}
+
+func tickerStatusPrint(t db.Ticker) string {
+	switch t.Status {
+	case db.TickerMissing:
+		return " - **message deleted**; run `/repair_tickers`"
+	case db.TickerForbidden:
+		return fmt.Sprintf(" - **can't be edited** (failed %v updates in a row); run `/repair_tickers`", t.Failures)
+	}
+	return ""
+}
+
+// Change what an existing ticker shows, editing its message in place.
+// Moving it to another channel posts it again there and deletes the old
+// message, keeping it pinned if it was.
+func HandleEditTicker(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	t, err := commandTicker(i, opts)
+	if err != nil {
+		RespondPrivate(s, i, err.Error())
+		return
+	}
+
+	picked, err := optionGames(opts)
+	if err != nil {
+		RespondPrivate(s, i, err.Error())
+		return
+	}
+	games := t.Games
+	if val, exists := opts["all_games"]; exists && val.BoolValue() {
+		games = []string{}
+	} else if len(picked) > 0 {
+		games = picked
+	}
+	style := t.Style
+	if val, exists := opts["style"]; exists {
+		style = db.TickerStyle(val.StringValue())
+	}
+	targetChannel := t.ChannelID
+	if val, exists := opts["channel"]; exists {
+		targetChannel = val.ChannelValue(nil).ID
+	}
+
+	render := renderTicker(db.Ticker{Games: games}.ShownGames(), style, true)
+	changes := ""
+
+	if targetChannel == t.ChannelID {
+		_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			Channel: t.ChannelID,
+			ID: t.MessageID,
+			Content: &render.Content,
+			Embeds: &render.Embeds,
+			Components: &render.Components,
+		})
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Error editing ticker: %v\nIf its message was deleted, use `/repair_tickers`.", err))
+			return
+		}
+	} else {
+		old, err := s.ChannelMessage(t.ChannelID, t.MessageID)
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Couldn't fetch ticker message: %v", err))
+			return
+		}
+		msg, err := s.ChannelMessageSendComplex(targetChannel, &discordgo.MessageSend{
+			Content: render.Content,
+			Embeds: render.Embeds,
+			Components: render.Components,
+		})
+		if err != nil {
+			RespondPrivate(s, i, fmt.Sprintf("Couldn't post ticker in <#%v>: %v", targetChannel, err))
+			return
+		}
+		if err = db.MoveTicker(t.MessageID, msg.ID, targetChannel); err != nil {
+			RespondPrivate(s, i, fmt.Sprintf(
+				"Posted ticker in <#%v> but can't save for updating: %v\n" +
+				"The new message will not update; please delete it.", targetChannel, err))
+			return
+		}
+		if err = s.ChannelMessageDelete(t.ChannelID, t.MessageID); err != nil {
+			changes += fmt.Sprintf("- Couldn't delete the old message: %v\n", err)
+		}
+		if _, exists := opts["pinned"]; !exists && old.Pinned {
+			if err = s.ChannelMessagePin(targetChannel, msg.ID); err != nil {
+				changes += fmt.Sprintf("- Couldn't pin the new message: %v\n", err)
+			}
+		}
+		t.MessageID = msg.ID
+		changes += fmt.Sprintf("- Moved to <#%v>\n", targetChannel)
+	}
+
+	if err = db.SetTickerGames(t.MessageID, games); err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Edited ticker but couldn't save its games: %v", err))
+		return
+	}
+	if err = db.SetTickerStyle(t.MessageID, style); err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Edited ticker but couldn't save its style: %v", err))
+		return
+	}
+	if err = db.MarkTickerUpdated(t.MessageID, render.Hash()); err != nil {
+		slog.Error(fmt.Sprintf("Error saving content hash of edited ticker %v: %v", t.MessageID, err))
+	}
+
+	if val, exists := opts["pinned"]; exists {
+		if val.BoolValue() {
+			err = s.ChannelMessagePin(targetChannel, t.MessageID)
+		} else {
+			err = s.ChannelMessageUnpin(targetChannel, t.MessageID)
+		}
+		if err != nil {
+			changes += fmt.Sprintf("- Couldn't change whether it's pinned: %v\n", err)
+		}
+	}
+
+	url := fmt.Sprintf(consts.MessageLinkTemplate, i.GuildID, targetChannel, t.MessageID)
+	RespondPrivate(s, i, fmt.Sprintf("Updated ticker %v to show %v as `%v`.\n%v", url, tickerGamesPrint(games), style, changes))
+}
+
+// Check on a ticker, fixing what can be fixed, and describe the outcome.
+func repairTicker(s *discordgo.Session, t db.Ticker, repost bool) string {
+	render := renderTicker(t.ShownGames(), t.Style, true)
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Channel: t.ChannelID,
+		ID: t.MessageID,
+		Content: &render.Content,
+		Embeds: &render.Embeds,
+		Components: &render.Components,
+	})
+	if err == nil {
+		if err = db.MarkTickerUpdated(t.MessageID, render.Hash()); err != nil {
+			return fmt.Sprintf("updated, but couldn't save its state: %v", err)
+		}
+		if t.Status != db.TickerOK {
+			return "fixed; updated successfully"
+		}
+		return "OK"
+	}
+
+	status, channelGone := tickerProblem(err)
+	switch {
+	case channelGone:
+		if err = db.RemoveTicker(t.MessageID); err != nil {
+			return fmt.Sprintf("channel was deleted, but couldn't stop tracking it: %v", err)
+		}
+		return "channel was deleted; stopped tracking it"
+	case status == db.TickerMissing && !repost:
+		if _, err = db.MarkTickerFailed(t.MessageID, status); err != nil {
+			return fmt.Sprintf("message was deleted; couldn't save its state: %v", err)
+		}
+		return "message was deleted; run again with `repost` to post it again"
+	case status == db.TickerMissing:
+		msg, err := s.ChannelMessageSendComplex(t.ChannelID, &discordgo.MessageSend{
+			Content: render.Content,
+			Embeds: render.Embeds,
+			Components: render.Components,
+		})
+		if err != nil {
+			return fmt.Sprintf("message was deleted and couldn't be posted again: %v", err)
+		}
+		if err = db.MoveTicker(t.MessageID, msg.ID, t.ChannelID); err != nil {
+			return fmt.Sprintf("message was deleted; posted it again but couldn't track the new one: %v", err)
+		}
+		if err = db.MarkTickerUpdated(msg.ID, render.Hash()); err != nil {
+			slog.Error(fmt.Sprintf("Error saving content hash of re-posted ticker %v: %v", msg.ID, err))
+		}
+		return "message was deleted; posted it again as " + fmt.Sprintf(consts.MessageLinkTemplate, t.GuildID, t.ChannelID, msg.ID)
+	case status == db.TickerForbidden:
+		failures, err := db.MarkTickerFailed(t.MessageID, status)
+		if err != nil {
+			return fmt.Sprintf("I can't edit it; couldn't save its state: %v", err)
+		}
+		return fmt.Sprintf("I can't edit it (failed %v updates in a row); make sure I can view <#%v> and read its message history", failures, t.ChannelID)
+	}
+	return fmt.Sprintf("couldn't check it: %v", err)
+}
+
+// Context menu: update a ticker now, fixing it if it's broken.
+func HandleRefreshTicker(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	t, err := commandTicker(i, opts)
+	if err != nil {
+		RespondPrivate(s, i, err.Error())
+		return
+	}
+	RespondPrivate(s, i, fmt.Sprintf("Ticker for %v: %v", tickerGamesPrint(t.Games), repairTicker(s, t, false)))
+}
+
+// Context menu: make a ticker show all games.
+func HandleConvertTickerMultiGame(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	t, err := commandTicker(i, opts)
+	if err != nil {
+		RespondPrivate(s, i, err.Error())
+		return
+	}
+	if len(t.Games) == 0 {
+		RespondPrivate(s, i, "This ticker already shows all games.")
+		return
+	}
+
+	render := renderTicker(consts.Games, t.Style, true)
+	_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		Channel: t.ChannelID,
+		ID: t.MessageID,
+		Content: &render.Content,
+		Embeds: &render.Embeds,
+		Components: &render.Components,
+	})
+	if err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Error editing ticker: %v", err))
+		return
+	}
+	if err = db.SetTickerGames(t.MessageID, []string{}); err != nil {
+		RespondPrivate(s, i, fmt.Sprintf("Edited ticker but couldn't save its games: %v", err))
+		return
+	}
+	if err = db.MarkTickerUpdated(t.MessageID, render.Hash()); err != nil {
+		slog.Error(fmt.Sprintf("Error saving content hash of edited ticker %v: %v", t.MessageID, err))
+	}
+	RespondPrivate(s, i, "Ticker now shows all games!")
+}
+
+func HandleRepairTickers(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
+	if i.GuildID == "" {
+		RespondPrivate(s, i, "Tickers can only be repaired in servers.")
+		return
+	}
+	repost := false
+	if val, exists := opts["repost"]; exists {
+		repost = val.BoolValue()
+	}
+
+	// checking every ticker can take longer than an interaction allows
+	DeferPrivate(s, i)
+
+	tickers, err := db.GetGuildTickers(i.GuildID)
+	if err != nil {
+		EditResponse(s, i, fmt.Sprintf("Error getting tickers of this server: %v", err))
+		return
+	}
+	if len(tickers) == 0 {
+		EditResponse(s, i, "There are no tickers in this server.")
+		return
+	}
+
+	out := fmt.Sprintf("**Ticker check for server ID %v**\n", i.GuildID)
+	for _, t := range tickers {
+		url := fmt.Sprintf(consts.MessageLinkTemplate, t.GuildID, t.ChannelID, t.MessageID)
+		out += fmt.Sprintf("- %v (%v): %v\n", url, tickerGamesPrint(t.Games), repairTicker(s, t, repost))
+	}
+	EditResponse(s, i, strings.Trim(out, " \t\n"))
+}
+
 func HandleActiveCodes(s *discordgo.Session, i *discordgo.InteractionCreate, opts CmdOptMap) {
 	game := opts["game"].StringValue()
 	embeds := tickerEmbeds(game, false)
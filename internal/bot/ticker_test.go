@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+)
+
+func TestCodesOnlyTickerFitsMessage(t *testing.T) {
+	games := []string{"Honkai Impact 3rd", "Genshin Impact", "Honkai Star Rail", "Zenless Zone Zero"}
+	tail := "**[Redemption page](https://example.com/redeem)**\n-# [Source](https://example.com) updated <t:1700000000:R>; checked at least every 4 hours."
+
+	embeds := []*discordgo.MessageEmbed{}
+	for _, game := range games {
+		codes := [][]string{}
+		for i := 0; i < 300; i++ {
+			codes = append(codes, []string{fmt.Sprintf("CODE%04dXYZ", i), "Primogems ×60"})
+		}
+		sections := []tickerSection{
+			{"", codes},
+			{"**Livestream codes (use ASAP!)**", codes[:3]},
+		}
+		embeds = append(embeds, compactEmbed(game, sections, tail, false, codesOnlyLimit(game, len(games))))
+	}
+
+	if !fitsMessage(embeds) {
+		total := 0
+		for _, e := range embeds {
+			total += embedLength(e)
+		}
+		t.Fatalf("expected %d embeds to fit a message, got %d characters", len(embeds), total)
+	}
+	for _, e := range embeds {
+		if n := utf8.RuneCountInString(e.Description); n > consts.EmbedDescriptionLimit {
+			t.Errorf("%v: description of %d characters exceeds embed limit", e.Title, n)
+		}
+		if !strings.Contains(e.Description, "…") {
+			t.Errorf("%v: expected cut-off codes to be marked", e.Title)
+		}
+		if !strings.HasSuffix(e.Description, tail) {
+			t.Errorf("%v: expected freshness to be kept", e.Title)
+		}
+		if strings.Contains(e.Description, "· \n") {
+			t.Errorf("%v: expected no dangling separator", e.Title)
+		}
+	}
+}
+
+func TestCompactCodeListUntruncated(t *testing.T) {
+	sections := []tickerSection{{"", [][]string{{"AAA", "a"}, {"BBB", "b"}}}}
+	if got, expected := compactCodeList("Genshin Impact", sections, false, 1000), "`AAA` · `BBB`\n"; got != expected {
+		t.Errorf("compactCodeList() = %q, expected %q", got, expected)
+	}
+	if got, expected := compactCodeList("Genshin Impact", []tickerSection{}, false, 1000), "No codes reported active.\n"; got != expected {
+		t.Errorf("compactCodeList() = %q, expected %q", got, expected)
+	}
+}
@@ -1,16 +1,22 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+	"github.com/muskit/hoyocodes-discord-bot/internal/delivery"
+	"github.com/muskit/hoyocodes-discord-bot/internal/schedule"
 	"github.com/muskit/hoyocodes-discord-bot/internal/scraper"
 	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
 	"github.com/muskit/hoyocodes-discord-bot/pkg/util"
@@ -18,13 +24,50 @@ import (
 
 var UpdatingMutex = sync.Mutex{}
 
+// When each game is scraped next; livestreams are added by syncLivestreams.
+var scrapeSchedule = schedule.New(schedule.Policy{
+	Default: consts.DefaultScrapeInterval,
+	Min: consts.MinScrapeInterval,
+	Max: consts.MaxScrapeInterval,
+	Livestream: consts.LivestreamScrapeInterval,
+	LivestreamTail: consts.LivestreamPollTail,
+}, consts.Games, nil, time.Now())
+
+// Set by /admin pause to hold back subscription notifications.
+var notificationsPaused atomic.Bool
+
+// How long community-reported codes stay active without the source listing
+// them; set by the community_code_lifetime env var.
+var communityCodeLifetime = consts.DefaultCommunityCodeLifetime
+
+// Routes delivered to at once; set by the delivery_concurrency env var.
+var deliveryConcurrency = consts.DefaultDeliveryConcurrency
+
 type CodeChanges struct {
 	Added [][]string
 	Removed [][]string
+	Flagged [][]string // reportedly expired by users
+	Livestream map[string]bool // codes in Added from a livestream
 }
 
-func UpdateRoutine(session *discordgo.Session, interruptCh chan<-os.Signal) {
+// Runs until ctx is cancelled, which also cuts short in-flight deliveries.
+func UpdateRoutine(ctx context.Context, session *discordgo.Session, interruptCh chan<-os.Signal) {
 	for {
+		nextUpdateTime := scrapeSchedule.NextRun()
+		slog.Info(fmt.Sprintf("Sleeping until %v", nextUpdateTime.Format(time.Kitchen)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-scrapeSchedule.Rescheduled():
+			continue
+		case <-time.After(time.Until(nextUpdateTime)):
+		}
+
+		due := scrapeSchedule.Due(time.Now())
+		if len(due) == 0 {
+			// rescheduled meanwhile, eg. by /admin refresh
+			continue
+		}
 		slog.Info("---------- Start update loop ----------")
 
 		// check session integrity
@@ -39,24 +82,32 @@ func UpdateRoutine(session *discordgo.Session, interruptCh chan<-os.Signal) {
 			return
 		}
 
-		UpdatingMutex.Lock()
-		changes := updateCodesDB()
-		updateTickers(session)
-		notifySubscribers(session, changes, false)
-		UpdatingMutex.Unlock()
-
-		nextUpdateTime := time.Now().Add(consts.UpdateInterval)
+		runUpdate(ctx, session, due)
 		slog.Info("Finished update loop!")
-		slog.Info(fmt.Sprintf("Sleeping for %v until %v", consts.UpdateInterval, nextUpdateTime.Format(time.Kitchen)))
-		<-time.After(time.Until(nextUpdateTime))
 	}
 }
 
-func updateCodesDB() map[string]*CodeChanges {
+// Scrape games (all if none are given), update tickers and notify
+// subscribers; returns the changes found.
+func runUpdate(ctx context.Context, session *discordgo.Session, games []string) map[string]*CodeChanges {
+	UpdatingMutex.Lock()
+	defer UpdatingMutex.Unlock()
+
+	changes := updateCodesDB(games)
+	updateTickers(ctx, session)
+	notifySubscribers(ctx, session, changes, false)
+	return changes
+}
+
+func updateCodesDB(games []string) map[string]*CodeChanges {
 	slog.Info("Update Codes Database")
 	changes := map[string]*CodeChanges{}
 
 	for _, cfg := range scraper.Configs {
+		if len(games) > 0 && !slices.Contains(games, cfg.Game) {
+			continue
+		}
+		_, prevUpdateTime, _ := db.GetScrapeTimes(cfg.Game)
 		checkTime := time.Now()
 		var updateTime time.Time
 		pageCodes := []string{}
@@ -67,17 +118,35 @@ func updateCodesDB() map[string]*CodeChanges {
 			updateTime, _ = time.Parse(time.RFC3339, updateTimeStr)
 			for code, desc := range codes {
 				pageCodes = append(pageCodes, code)
-				if err := db.AddCode(code, cfg.Game, desc, livestream, updateTime); err != nil {
-					if !db.IsDuplicateErr(err) {
-						log.Fatalf("Error adding code to database: %v\n", err)
+				err := db.AddCode(code, cfg.Game, desc, livestream, updateTime, db.SourcePocketTactics)
+				if db.IsDuplicateErr(err) {
+					if err := db.ClaimCommunityCode(code, cfg.Game); err != nil {
+						log.Fatalf("Error claiming community code in database: %v\n", err)
 					}
-				} else {
-					// new code added
-					slog.Debug("Found new code!", "game", cfg.Game, "code", code)
-					if _, exists := changes[cfg.Game]; !exists {
-						changes[cfg.Game] = &CodeChanges{}
+					// known code; announce it again if the source had dropped it (codes
+					// moderators confirmed expired stay removed)
+					restored, err := db.RestoreCode(code, cfg.Game, desc, livestream, updateTime, db.SourcePocketTactics)
+					if err != nil {
+						log.Fatalf("Error restoring code in database: %v\n", err)
 					}
-					changes[cfg.Game].Added = append(changes[cfg.Game].Added, []string{code, desc})
+					if !restored {
+						continue
+					}
+				} else if err != nil {
+					log.Fatalf("Error adding code to database: %v\n", err)
+				}
+
+				// new code added
+				slog.Debug("Found new code!", "game", cfg.Game, "code", code)
+				if _, exists := changes[cfg.Game]; !exists {
+					changes[cfg.Game] = &CodeChanges{}
+				}
+				changes[cfg.Game].Added = append(changes[cfg.Game].Added, []string{code, desc})
+				if livestream {
+					if changes[cfg.Game].Livestream == nil {
+						changes[cfg.Game].Livestream = map[string]bool{}
+					}
+					changes[cfg.Game].Livestream[code] = true
 				}
 			}
 			// set for next check
@@ -90,6 +159,13 @@ func updateCodesDB() map[string]*CodeChanges {
 		if err != nil {
 			log.Fatalf("Error getting removed codes for %v: %v", cfg.Game, err)
 		}
+		// the source drops codes it never listed without us noticing, so
+		// community codes are assumed expired after a while
+		stale, err := db.GetStaleCommunityCodes(cfg.Game, checkTime.Add(-communityCodeLifetime))
+		if err != nil {
+			log.Fatalf("Error getting stale community codes for %v: %v", cfg.Game, err)
+		}
+		removed = append(removed, stale...)
 		if len(removed) > 0 {
 			if _, exists := changes[cfg.Game]; !exists {
 				changes[cfg.Game] = &CodeChanges{}
@@ -100,13 +176,19 @@ func updateCodesDB() map[string]*CodeChanges {
 			}
 			
 			if err := db.RemoveCodes(removed, cfg.Game); err != nil {
-				log.Fatalf("Error deleting removed codes from db: %v", err)
+				log.Fatalf("Error marking removed codes in db: %v", err)
 			}
 		}
 
 		if err := db.SetScrapeTimes(cfg.Game, updateTime, checkTime); err != nil {
 			log.Fatalf("Error updating scrape times for %v: %v", cfg.Game, err)
 		}
+
+		// poll again sooner if the page moved at all
+		_, changed := changes[cfg.Game]
+		changed = changed || !updateTime.Equal(prevUpdateTime)
+		next := scrapeSchedule.Done(cfg.Game, changed, time.Now())
+		slog.Info(fmt.Sprintf("Next check of %v at %v", cfg.Game, next.Format(time.Kitchen)))
 	}
 
 	if len(changes) > 0 {
@@ -132,24 +214,20 @@ func updateCodesDB() map[string]*CodeChanges {
 	return changes
 }
 
-func updateTickers(session *discordgo.Session) {
+func updateTickers(ctx context.Context, session *discordgo.Session) {
 	slog.Info("Update Tickers")
-	
-	for _, g := range consts.Games {
-		game := g
-		UpdateEmbedTickersGame(session, game)
-		// UpdateTextTickersGame(session, game)
-	}
+	UpdateTickers(ctx, session)
 }
 
 func ShouldNotify(sub db.Subscription, chg CodeChanges) bool {
 	if (!sub.AnnounceAdds && !sub.AnnounceRems) ||
-		(len(chg.Added) == 0 && len(chg.Removed) == 0) {
+		(len(chg.Added) == 0 && len(chg.Removed) == 0 && len(chg.Flagged) == 0) {
 		return false
 	}
 
+	// flagged codes are likely on their way out
 	return (sub.AnnounceAdds && len(chg.Added) > 0) ||
-		(sub.AnnounceRems && len(chg.Removed) > 0)
+		(sub.AnnounceRems && (len(chg.Removed) > 0 || len(chg.Flagged) > 0))
 }
 
 func notifyContent(game string, chgs CodeChanges) string {
@@ -169,6 +247,10 @@ func notifyContent(game string, chgs CodeChanges) string {
 		content += "**REMOVED:**\n"
 		content += util.CodeListing(chgs.Removed, nil) + "\n"
 	}
+	if len(chgs.Flagged) > 0 {
+		content += "**REPORTEDLY EXPIRED:**\n"
+		content += util.CodeListing(chgs.Flagged, nil) + "\n"
+	}
 
 	if link, exists := consts.RedeemURL[game]; exists {
 		content += fmt.Sprintf("\n[Redemption page](<%v>)\n", link)
@@ -180,61 +262,135 @@ func notifyContent(game string, chgs CodeChanges) string {
 	return content
 }
 
-func notifySubscribers(session *discordgo.Session, gameChanges map[string]*CodeChanges, dryrun bool) {
+func notifySubscribers(ctx context.Context, session *discordgo.Session, gameChanges map[string]*CodeChanges, dryrun bool) {
 	if len(gameChanges) == 0 {
 		slog.Info("No changes to notify subscribers of")
 		return
 	}
 
-	slog.Info("Notify Subscribed Channels")
+	if notificationsPaused.Load() && !dryrun {
+		slog.Info("Notifications are paused; not notifying subscribers")
+		return
+	}
 
+	slog.Info("Notify Subscribed Channels")
 
+	now := time.Now()
+	settings := map[string]db.GuildSettings{}
+	jobs := []delivery.Job{}
 	for game, chgs := range gameChanges {
 		subscriptions, err := db.GetGameSubscriptions(game)
 		if err != nil {
 			log.Fatalf("Error getting subscriptions for %v: %v", game, err)
 		}
 
-		// notification message for game
-		content := notifyContent(game, *chgs)
-
 		for _, sub := range subscriptions {
 			if !ShouldNotify(sub, *chgs) {
 				continue
 			}
 
-			subMsg := content
+			if sub.Digest.Frequency != db.DigestOff {
+				if dryrun {
+					slog.Debug(fmt.Sprintf("for %v: queued for %v digest", sub.ChannelID, sub.Digest.Frequency))
+				} else if err := queueDigest(sub, game, *chgs); err != nil {
+					slog.Error(fmt.Sprintf("Error queueing digest for %v: %v", sub.ChannelID, err))
+				}
+				continue
+			}
 
-			// prepend role mentions
-			roles, err := db.GetPingRoles(sub.ChannelID)
-			if err != nil {
-				log.Fatalf("Error getting ping roles for subscription %v: %v", sub.ChannelID, err)
+			// hold back what can wait until the guild's quiet hours end
+			chg := *chgs
+			if _, exists := settings[sub.GuildID]; !exists {
+				settings[sub.GuildID] = guildSettings(sub.GuildID)
 			}
-			if len(roles) > 0 {
-				mentions := "||"
-				for _, r := range roles {
-					mentions += fmt.Sprintf("<@&%v> ", r)
+			if g := settings[sub.GuildID]; inQuietHours(g, now) {
+				urgent, deferred := splitQuietChanges(g, chg)
+				if dryrun {
+					slog.Debug(fmt.Sprintf("for %v: deferred until quiet hours end", sub.ChannelID))
+				} else if err := queueDigest(sub, game, deferred); err != nil {
+					slog.Error(fmt.Sprintf("Error deferring changes for %v: %v", sub.ChannelID, err))
+				}
+				if !ShouldNotify(sub, urgent) {
+					continue
 				}
-				subMsg = content + strings.Trim(mentions, " ") + "||\n"
+				chg = urgent
 			}
 
+			mentions := pingMentions(sub.ChannelID, game)
+			n := &notification{sub: sub, game: game, msgs: notifyMessages(game, chg, sub.Format, mentions)}
+
 			if dryrun { 
-				slog.Debug(fmt.Sprintf("for %v:\n%s", sub.ChannelID, subMsg))
+				for _, msg := range n.msgs {
+					slog.Debug(fmt.Sprintf("for %v:\n%s (%v embeds)", sub.ChannelID, msg.Content, len(msg.Embeds)))
+				}
 				continue
 			}
 
-			if _, err := session.ChannelMessageSend(sub.ChannelID, subMsg); err != nil {
-				if strings.Contains(err.Error(), "HTTP 403") {
-					// Forbidden: no permission to post
-					slog.Warn(fmt.Sprintf("HTTP Forbidden 403 sending subscription notification: %v", err))
-				} else if strings.Contains(err.Error(), "HTTP 404") {
-					// Not found: channel or message
-					// TODO: delete subscription from DB?
-					slog.Warn(fmt.Sprintf("HTTP Not Found 404 sending subscription notification: %v", err))
-				} else {
-					log.Fatalf("Error sending subscription notification to %v: %v", sub.ChannelID, err)
-				}
-			}
+			jobs = append(jobs, delivery.Job{
+				Route: sub.ChannelID,
+				Do: func(opts ...discordgo.RequestOption) error {
+					return n.deliver(session, opts...)
+				},
+				Done: func(err error) {
+					handleNotifyError(sub, err)
+				},
+			})
 		}
 	}
-}
\ No newline at end of file
+
+	stats := delivery.Run(ctx, deliveryConcurrency, consts.DeliveryMaxRetries, jobs)
+	slog.Info(fmt.Sprintf("Notification delivery: %v", stats))
+}
+
+// Role mentions to append to a game's notification for a subscription;
+// empty if it pings no one.
+func pingMentions(channelID string, game string) string {
+	roles, err := db.GetGamePingRoles(channelID, game)
+	if err != nil {
+		log.Fatalf("Error getting ping roles for subscription %v: %v", channelID, err)
+	}
+	if len(roles) == 0 {
+		return ""
+	}
+	mentions := "||"
+	for _, r := range roles {
+		mentions += fmt.Sprintf("<@&%v> ", r)
+	}
+	return strings.Trim(mentions, " ") + "||\n"
+}
+
+// Log a failed delivery to a subscription, cleaning it up if its channel is gone.
+func handleNotifyError(sub db.Subscription, err error) {
+	switch {
+	case err == nil:
+	case delivery.StatusCode(err) == http.StatusForbidden:
+		// Forbidden: no permission to post
+		slog.Warn(fmt.Sprintf("HTTP Forbidden 403 sending subscription notification: %v", err))
+	case delivery.ErrorCode(err) == discordgo.ErrCodeUnknownChannel:
+		// channel is gone; threads are restarted by deliver()
+		if sub.Target.Mode == db.DeliverForum {
+			slog.Info(fmt.Sprintf("Forum %v of subscription %v is gone; posting in the channel instead", sub.Target.ForumID, sub.ChannelID))
+			err = db.ResetForumSubscriptions(sub.Target.ForumID)
+		} else {
+			slog.Info(fmt.Sprintf("Subscribed channel %v is gone; deleting subscription", sub.ChannelID))
+			err = db.DeleteSubscription(sub.ChannelID)
+		}
+		if err != nil {
+			slog.Error(fmt.Sprintf("Error cleaning up subscription %v: %v", sub.ChannelID, err))
+		}
+	case delivery.StatusCode(err) == http.StatusNotFound:
+		slog.Warn(fmt.Sprintf("HTTP Not Found 404 sending subscription notification: %v", err))
+	default:
+		slog.Error(fmt.Sprintf("Error sending subscription notification to %v: %v", sub.ChannelID, err))
+	}
+}
+
+// Announce code changes found outside the update loop, eg. approved reports.
+func announceCodeChanges(session *discordgo.Session, changes map[string]*CodeChanges) {
+	UpdatingMutex.Lock()
+	defer UpdatingMutex.Unlock()
+
+	ctx := context.Background()
+	updateTickers(ctx, session)
+	notifySubscribers(ctx, session, changes, false)
+}
@@ -38,6 +38,28 @@ func TestShouldNotify(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "should notify on flagged codes with removals",
+			sub: db.Subscription{
+				AnnounceAdds: true,
+				AnnounceRems: true,
+			},
+			chg: bot.CodeChanges{
+				Flagged: [][]string{{"XYZ789", "Description"}},
+			},
+			expected: true,
+		},
+		{
+			name: "should not notify on flagged codes without removals",
+			sub: db.Subscription{
+				AnnounceAdds: true,
+				AnnounceRems: false,
+			},
+			chg: bot.CodeChanges{
+				Flagged: [][]string{{"XYZ789", "Description"}},
+			},
+			expected: false,
+		},
 		{
 			name: "should not notify when no changes",
 			sub: db.Subscription{
@@ -12,7 +12,7 @@ import (
 	"github.com/joho/godotenv"
 )
 
-const connStrCfg = "%s:%s@tcp(%s:%s)/guild_cfg"
+const connStrCfg = "%s:%s@tcp(%s:%s)/guild_cfg?parseTime=true"
 const connStrScraper = "%s:%s@tcp(%s:%s)/scraper?parseTime=true"
 
 var DBCfg *sql.DB
@@ -0,0 +1,92 @@
+package db
+
+import "time"
+
+// What happened to a code queued for a digest.
+type DigestChange string
+
+const (
+	DigestAdded DigestChange = "added"
+	DigestRemoved DigestChange = "removed"
+	DigestFlagged DigestChange = "flagged" // reportedly expired
+)
+
+type DigestEntry struct {
+	Game string
+	Code string
+	Description string
+	Change DigestChange
+}
+
+func SetSubscriptionDigest(channelID string, d Digest) error {
+	_, err := DBCfg.Exec("UPDATE Subscriptions SET digest = ?, digest_minute = ?, digest_weekday = ?, digest_timezone = ?, digest_last = ? WHERE channel_id = ?",
+		d.Frequency, d.Minute, d.Weekday, d.Timezone, d.Last, channelID)
+	return err
+}
+
+// Record that a subscription's digest due at the given time was handled.
+func SetDigestLast(channelID string, last time.Time) error {
+	_, err := DBCfg.Exec("UPDATE Subscriptions SET digest_last = ? WHERE channel_id = ?", last, channelID)
+	return err
+}
+
+// Active subscriptions sending digests.
+func GetDigestSubscriptions() ([]Subscription, error) {
+	sels, err := DBCfg.Query("SELECT " + subscriptionCols + " FROM Subscriptions WHERE active = TRUE AND digest != 'off'")
+	if err != nil {
+		return []Subscription{}, err
+	}
+	return scanSubscriptions(sels)
+}
+
+// Active subscriptions announcing each change that have changes queued,
+// held back during quiet hours.
+func GetDeferredSubscriptions() ([]Subscription, error) {
+	sels, err := DBCfg.Query("SELECT " + subscriptionCols + " FROM Subscriptions WHERE active = TRUE AND digest = 'off' AND channel_id IN (SELECT channel_id FROM DigestQueue)")
+	if err != nil {
+		return []Subscription{}, err
+	}
+	return scanSubscriptions(sels)
+}
+
+// Queue changed codes ([code, description]) of a game for a subscription's
+// next digest, or until its quiet hours end. Codes already queued for the same change are kept once.
+func QueueDigestChanges(channelID string, game string, change DigestChange, codes [][]string, queued time.Time) error {
+	for _, c := range codes {
+		_, err := DBCfg.Exec("INSERT INTO DigestQueue SET channel_id = ?, game = ?, code = ?, description = ?, change_type = ?, queued = ? ON DUPLICATE KEY UPDATE description = ?",
+			channelID, game, c[0], c[1], change, queued, c[1])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Changes queued for a subscription up to a time, oldest first.
+func GetDigestQueue(channelID string, until time.Time) ([]DigestEntry, error) {
+	ret := []DigestEntry{}
+	sels, err := DBCfg.Query("SELECT game, code, description, change_type FROM DigestQueue WHERE channel_id = ? AND queued <= ? ORDER BY queued ASC", channelID, until)
+	if err != nil {
+		return ret, err
+	}
+	for sels.Next() {
+		e := DigestEntry{}
+		if err := sels.Scan(&e.Game, &e.Code, &e.Description, &e.Change); err != nil {
+			return ret, err
+		}
+		ret = append(ret, e)
+	}
+	return ret, sels.Err()
+}
+
+// Forget changes queued up to a time, once they've been sent.
+func ClearDigestQueue(channelID string, until time.Time) error {
+	_, err := DBCfg.Exec("DELETE FROM DigestQueue WHERE channel_id = ? AND queued <= ?", channelID, until)
+	return err
+}
+
+// Forget a game's changes queued up to a time, once they've been sent.
+func ClearDigestQueueGame(channelID string, game string, until time.Time) error {
+	_, err := DBCfg.Exec("DELETE FROM DigestQueue WHERE channel_id = ? AND game = ? AND queued <= ?", channelID, game, until)
+	return err
+}
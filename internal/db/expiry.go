@@ -0,0 +1,49 @@
+package db
+
+import "time"
+
+// Record a user's report that a code expired; voting again refreshes it.
+func AddExpiryVote(code string, game string, userID string, voted time.Time) error {
+	_, err := DBScraper.Exec("INSERT INTO ExpiryVotes SET code = ?, game = ?, user_id = ?, voted = ? ON DUPLICATE KEY UPDATE voted = ?", code, game, userID, voted, voted)
+	return err
+}
+
+func CountExpiryVotes(code string, game string, since time.Time) (int, error) {
+	var n int
+	err := DBScraper.QueryRow("SELECT COUNT(*) FROM ExpiryVotes WHERE code = ? AND game = ? AND voted >= ?", code, game, since).Scan(&n)
+	return n, err
+}
+
+// Mark an active code as reportedly expired; returns false if it already was.
+func FlagCode(code string, game string) (bool, error) {
+	res, err := DBScraper.Exec("UPDATE Codes SET flagged = ? WHERE code = ? AND game = ? AND flagged IS NULL AND removed IS NULL", time.Now(), code, game)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Unflag a code and forget the votes against it.
+func ClearCodeFlag(code string, game string) error {
+	if _, err := DBScraper.Exec("UPDATE Codes SET flagged = NULL WHERE code = ? AND game = ?", code, game); err != nil {
+		return err
+	}
+	_, err := DBScraper.Exec("DELETE FROM ExpiryVotes WHERE code = ? AND game = ?", code, game)
+	return err
+}
+
+// Active codes of a game reported expired.
+func GetFlaggedCodes(game string) (map[string]bool, error) {
+	ret := map[string]bool{}
+	sels, err := DBScraper.Query("SELECT code FROM Codes WHERE game = ? AND flagged IS NOT NULL AND removed IS NULL", game)
+	if err != nil {
+		return ret, err
+	}
+	for sels.Next() {
+		var code string
+		sels.Scan(&code)
+		ret[code] = true
+	}
+	return ret, sels.Err()
+}
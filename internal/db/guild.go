@@ -0,0 +1,51 @@
+package db
+
+import "database/sql"
+
+// A guild's notification preferences.
+type GuildSettings struct {
+	Timezone string // IANA name, eg. Asia/Tokyo
+	QuietStart int // minute of the day in Timezone
+	QuietEnd int // equal to QuietStart for no quiet hours
+	LivestreamBypass bool // announce livestream codes during quiet hours
+}
+
+var DefaultGuildSettings = GuildSettings{Timezone: "UTC", LivestreamBypass: true}
+
+// Record a guild the bot is in; returns whether it wasn't known before.
+func AddGuild(guildID string) (bool, error) {
+	res, err := DBCfg.Exec("INSERT IGNORE INTO Guilds SET guild_id = ?", guildID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func RemoveGuild(guildID string) error {
+	_, err := DBCfg.Exec("DELETE FROM Guilds WHERE guild_id = ?", guildID)
+	return err
+}
+
+func CountGuilds() (int, error) {
+	var n int
+	err := DBCfg.QueryRow("SELECT COUNT(*) FROM Guilds").Scan(&n)
+	return n, err
+}
+
+// Defaults if the guild isn't known.
+func GetGuildSettings(guildID string) (GuildSettings, error) {
+	g := GuildSettings{}
+	row := DBCfg.QueryRow("SELECT timezone, quiet_start, quiet_end, quiet_livestream_bypass FROM Guilds WHERE guild_id = ?", guildID)
+	err := row.Scan(&g.Timezone, &g.QuietStart, &g.QuietEnd, &g.LivestreamBypass)
+	if err == sql.ErrNoRows {
+		return DefaultGuildSettings, nil
+	}
+	return g, err
+}
+
+func SetGuildSettings(guildID string, g GuildSettings) error {
+	_, err := DBCfg.Exec("INSERT INTO Guilds SET guild_id = ?, timezone = ?, quiet_start = ?, quiet_end = ?, quiet_livestream_bypass = ? ON DUPLICATE KEY UPDATE timezone = ?, quiet_start = ?, quiet_end = ?, quiet_livestream_bypass = ?",
+		guildID, g.Timezone, g.QuietStart, g.QuietEnd, g.LivestreamBypass, g.Timezone, g.QuietStart, g.QuietEnd, g.LivestreamBypass)
+	return err
+}
@@ -0,0 +1,82 @@
+package db
+
+import "time"
+
+// A scheduled livestream of a game, which usually comes with codes.
+type Livestream struct {
+	ID int64
+	Game string
+	Title string
+	Start time.Time
+	End time.Time
+	Announced bool
+	RoundedUp bool
+}
+
+const livestreamCols = "id, game, title, start, end, announced, rounded_up"
+
+// Add a livestream; returns false if the game already has one at that start.
+func AddLivestream(l Livestream) (bool, error) {
+	res, err := DBScraper.Exec("INSERT IGNORE INTO Livestreams SET game = ?, title = ?, start = ?, end = ?", l.Game, l.Title, l.Start, l.End)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Returns false if there's no such livestream.
+func RemoveLivestream(id int64) (bool, error) {
+	res, err := DBScraper.Exec("DELETE FROM Livestreams WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Livestreams ending after the given time, soonest first.
+func GetLivestreams(endAfter time.Time) ([]Livestream, error) {
+	ret := []Livestream{}
+	sels, err := DBScraper.Query("SELECT "+livestreamCols+" FROM Livestreams WHERE end > ? ORDER BY start ASC", endAfter)
+	if err != nil {
+		return ret, err
+	}
+	defer sels.Close()
+	for sels.Next() {
+		l := Livestream{}
+		if err := sels.Scan(&l.ID, &l.Game, &l.Title, &l.Start, &l.End, &l.Announced, &l.RoundedUp); err != nil {
+			return ret, err
+		}
+		ret = append(ret, l)
+	}
+	return ret, sels.Err()
+}
+
+func MarkLivestreamAnnounced(id int64) error {
+	_, err := DBScraper.Exec("UPDATE Livestreams SET announced = TRUE WHERE id = ?", id)
+	return err
+}
+
+func MarkLivestreamRoundedUp(id int64) error {
+	_, err := DBScraper.Exec("UPDATE Livestreams SET rounded_up = TRUE WHERE id = ?", id)
+	return err
+}
+
+// Livestream codes of a game added within a time range, oldest first.
+func GetLivestreamCodes(game string, from time.Time, to time.Time) ([][]string, error) {
+	codes := [][]string{}
+	sels, err := DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = TRUE AND added >= ? AND added <= ? ORDER BY added ASC", game, from, to)
+	if err != nil {
+		return codes, err
+	}
+	defer sels.Close()
+	for sels.Next() {
+		var code, desc string
+		if err := sels.Scan(&code, &desc); err != nil {
+			return codes, err
+		}
+		codes = append(codes, []string{code, desc})
+	}
+	return codes, sels.Err()
+}
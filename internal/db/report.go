@@ -0,0 +1,69 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ReportStatus string
+
+const (
+	ReportPending ReportStatus = "pending"
+	ReportApproved ReportStatus = "approved"
+	ReportRejected ReportStatus = "rejected"
+)
+
+// A code submitted by a user, awaiting or past moderator review.
+type CodeReport struct {
+	ID int64
+	Code string
+	Game string
+	Description string
+	Livestream bool
+	ReporterID string
+	Reported time.Time
+	Status ReportStatus
+	ReviewerID string
+}
+
+func AddCodeReport(r CodeReport) (int64, error) {
+	res, err := DBScraper.Exec("INSERT INTO CodeReports SET code = ?, game = ?, description = ?, is_livestream = ?, reporter_id = ?, reported = ?",
+		r.Code, r.Game, r.Description, r.Livestream, r.ReporterID, r.Reported)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Returns sql.ErrNoRows if there's no such report.
+func GetCodeReport(id int64) (CodeReport, error) {
+	r := CodeReport{}
+	var reviewer sql.NullString
+	row := DBScraper.QueryRow("SELECT id, code, game, description, is_livestream, reporter_id, reported, status, reviewer_id FROM CodeReports WHERE id = ?", id)
+	err := row.Scan(&r.ID, &r.Code, &r.Game, &r.Description, &r.Livestream, &r.ReporterID, &r.Reported, &r.Status, &reviewer)
+	r.ReviewerID = reviewer.String
+	return r, err
+}
+
+// Settle a pending report; returns false if it was already reviewed.
+func ReviewCodeReport(id int64, status ReportStatus, reviewerID string) (bool, error) {
+	res, err := DBScraper.Exec("UPDATE CodeReports SET status = ?, reviewer_id = ? WHERE id = ? AND status = 'pending'", status, reviewerID, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func HasPendingCodeReport(code string, game string) (bool, error) {
+	var n int
+	err := DBScraper.QueryRow("SELECT COUNT(*) FROM CodeReports WHERE code = ? AND game = ? AND status = 'pending'", code, game).Scan(&n)
+	return n > 0, err
+}
+
+// How many codes a user reported since the given time.
+func CountUserCodeReports(userID string, since time.Time) (int, error) {
+	var n int
+	err := DBScraper.QueryRow("SELECT COUNT(*) FROM CodeReports WHERE reporter_id = ? AND reported >= ?", userID, since).Scan(&n)
+	return n, err
+}
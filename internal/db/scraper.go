@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
@@ -20,32 +21,153 @@ const (
 	UnrecentSinceLatest
 )
 
-func AddCode(code string, game string, description string, livestream bool, foundTime time.Time) error {
-	_, err := DBScraper.Exec("INSERT INTO Codes SET code = ?, game = ?, description = ?, is_livestream = ?, added = ?", code, game, description, livestream, foundTime)
+// Where a code was found.
+type CodeSource string
+
+const (
+	SourcePocketTactics CodeSource = "pockettactics"
+	SourceCommunity CodeSource = "community"
+)
+
+func AddCode(code string, game string, description string, livestream bool, foundTime time.Time, source CodeSource) error {
+	_, err := DBScraper.Exec("INSERT INTO Codes SET code = ?, game = ?, description = ?, is_livestream = ?, added = ?, source = ?", code, game, description, livestream, foundTime, source)
+	return err
+}
+
+// Hand a community-reported code over to the source once it lists it, so
+// it's removed when the source drops it.
+func ClaimCommunityCode(code string, game string) error {
+	_, err := DBScraper.Exec("UPDATE Codes SET source = 'pockettactics' WHERE code = ? AND game = ? AND source = 'community'", code, game)
 	return err
 }
 
+// Who removed a code.
+type Remover string
+
+const (
+	RemovedBySource Remover = "source"
+	RemovedByModerator Remover = "moderator"
+)
+
+// Whether a code may be made active again after being found by source.
+// Codes moderators confirmed expired stay removed even though the source
+// still lists them; only a community report approved by a moderator
+// brings them back.
+func Restorable(info CodeInfo, source CodeSource) bool {
+	if info.Removed.IsZero() {
+		return false
+	}
+	return info.RemovedBy != RemovedByModerator || source == SourceCommunity
+}
+
+// Make a removed code active again if it's Restorable; returns whether it
+// was restored.
+func RestoreCode(code string, game string, description string, livestream bool, foundTime time.Time, source CodeSource) (bool, error) {
+	sels, err := DBScraper.Query(codeInfoSelect + "WHERE code = ? AND game = ?", code, game)
+	if err != nil {
+		return false, err
+	}
+	infos, err := scanCodeInfos(sels)
+	if err != nil || len(infos) == 0 || !Restorable(infos[0], source) {
+		return false, err
+	}
+
+	res, err := DBScraper.Exec("UPDATE Codes SET description = ?, is_livestream = ?, added = ?, source = ?, removed = NULL, removed_by = NULL, flagged = NULL WHERE code = ? AND game = ? AND removed IS NOT NULL", description, livestream, foundTime, source, code, game)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Mark codes as removed, keeping them for lookups.
+//
 // input is slice of code,description pairs
 func RemoveCodes(codes [][]string, game string) error {
-	deleteArgs := make([]any, len(codes) + 1)
-	deleteArgs[0] = game
+	removeArgs := make([]any, len(codes) + 2)
+	removeArgs[0] = time.Now()
+	removeArgs[1] = game
 	for i, v := range codes {
-		deleteArgs[i+1] = v[0]
+		removeArgs[i+2] = v[0]
 	}
 
-	q := fmt.Sprintf("DELETE FROM Codes WHERE game = ? AND code IN (%s)", Placeholders(len(codes)))
-	_, err := DBScraper.Exec(q, deleteArgs...)
+	q := fmt.Sprintf("UPDATE Codes SET removed = ?, removed_by = 'source' WHERE game = ? AND code IN (%s)", Placeholders(len(codes)))
+	_, err := DBScraper.Exec(q, removeArgs...)
+
+	return err
+}
 
+// Mark a code as confirmed expired by a moderator. Unlike codes the source
+// dropped, it isn't restored while the source keeps listing it.
+func ExpireCode(code string, game string) error {
+	_, err := DBScraper.Exec("UPDATE Codes SET removed = ?, removed_by = 'moderator', flagged = NULL WHERE code = ? AND game = ? AND removed IS NULL", time.Now(), code, game)
 	return err
 }
 
+// A code as known to the bot, active or not.
+type CodeInfo struct {
+	Code string
+	Game string
+	Description string
+	Livestream bool
+	Added time.Time
+	Removed time.Time // zero while active
+	RemovedBy Remover // empty while active
+	Source CodeSource
+}
+
+const codeInfoSelect = "SELECT code, game, description, is_livestream, added, removed, removed_by, source FROM Codes "
+
+func scanCodeInfos(sels *sql.Rows) ([]CodeInfo, error) {
+	ret := []CodeInfo{}
+	for sels.Next() {
+		c := CodeInfo{}
+		var removed sql.NullTime
+		var removedBy sql.NullString
+		if err := sels.Scan(&c.Code, &c.Game, &c.Description, &c.Livestream, &c.Added, &removed, &removedBy, &c.Source); err != nil {
+			return ret, err
+		}
+		c.Removed = removed.Time
+		c.RemovedBy = Remover(removedBy.String)
+		ret = append(ret, c)
+	}
+	return ret, sels.Err()
+}
+
+// Codes containing query, active ones and most recent first.
+func SearchCodes(query string, limit int) ([]CodeInfo, error) {
+	pattern := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(query) + "%"
+	sels, err := DBScraper.Query(codeInfoSelect + "WHERE code LIKE ? ORDER BY removed IS NULL DESC, added DESC LIMIT ?", pattern, limit)
+	if err != nil {
+		return []CodeInfo{}, err
+	}
+	return scanCodeInfos(sels)
+}
+
+// Every game's entry for a code.
+func LookupCode(code string) ([]CodeInfo, error) {
+	sels, err := DBScraper.Query(codeInfoSelect + "WHERE code = ? ORDER BY game", code)
+	if err != nil {
+		return []CodeInfo{}, err
+	}
+	return scanCodeInfos(sels)
+}
+
 func GetMostRecentCodeTime(game string) (time.Time, error) {
 	var time time.Time
-	sel := DBScraper.QueryRow("SELECT added FROM Codes WHERE game = ? ORDER BY added DESC", game)
+	sel := DBScraper.QueryRow("SELECT added FROM Codes WHERE game = ? AND removed IS NULL ORDER BY added DESC", game)
 	err := sel.Scan(&time)
 	return time, err
 }
 
+// Returns when the latest livestream code was added; zero time if there are none.
+func GetLatestLivestreamTime(game string) (time.Time, error) {
+	var latest sql.NullTime
+	sel := DBScraper.QueryRow("SELECT MAX(added) FROM Codes WHERE game = ? AND is_livestream = TRUE", game)
+	err := sel.Scan(&latest)
+	return latest.Time, err
+}
+
 func GetCodes(game string, recency CodeRecencyOption, livestream bool) [][]string {
 	var sels *sql.Rows
 	var err error
@@ -53,7 +175,7 @@ func GetCodes(game string, recency CodeRecencyOption, livestream bool) [][]strin
 
 	switch recency {
 	case All:
-		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? ORDER BY added ASC", game, livestream)
+		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND removed IS NULL ORDER BY added ASC", game, livestream)
 	case RecentSinceLatest:
 		// get most recent code's added datetime
 		recentTime, rerr := GetMostRecentCodeTime(game)
@@ -62,7 +184,7 @@ func GetCodes(game string, recency CodeRecencyOption, livestream bool) [][]strin
 		}
 		// get codes added within 24 hours before the most recent
 		oldestTime := recentTime.Add(-consts.RecentSinceLatestThreshold)
-		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND added >= ? ORDER BY added ASC", game, livestream, oldestTime)
+		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND removed IS NULL AND added >= ? ORDER BY added ASC", game, livestream, oldestTime)
 	case UnrecentSinceLatest:
 		// get most recent code's added datetime
 		recentTime, rerr := GetMostRecentCodeTime(game)
@@ -71,13 +193,13 @@ func GetCodes(game string, recency CodeRecencyOption, livestream bool) [][]strin
 		}
 		// select codes added older than 24 hours before the most recent
 		oldestTime := recentTime.Add(-consts.RecentSinceLatestThreshold)
-		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND added < ? ORDER BY added ASC", game, livestream, oldestTime)
+		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND removed IS NULL AND added < ? ORDER BY added ASC", game, livestream, oldestTime)
 	case Recent:
 		oldestTime := time.Now().Add(-consts.RecentThreshold)
-		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND added >= ? ORDER BY added ASC", game, livestream, oldestTime)
+		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND removed IS NULL AND added >= ? ORDER BY added ASC", game, livestream, oldestTime)
 	case Unrecent:
 		oldestTime := time.Now().Add(-consts.RecentThreshold)
-		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND added < ? ORDER BY added ASC", game, livestream, oldestTime)
+		sels, err = DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND is_livestream = ? AND removed IS NULL AND added < ? ORDER BY added ASC", game, livestream, oldestTime)
 	}
 	
 	if err != nil {
@@ -97,6 +219,24 @@ func GetCodes(game string, recency CodeRecencyOption, livestream bool) [][]strin
 	return codes
 }
 
+// Active community-reported codes of a game the source hasn't listed since
+// before a time.
+func GetStaleCommunityCodes(game string, before time.Time) ([][]string, error) {
+	result := [][]string{}
+	sels, err := DBScraper.Query("SELECT code, description FROM Codes WHERE game = ? AND removed IS NULL AND source = 'community' AND added < ?", game, before)
+	if err != nil {
+		return result, err
+	}
+	for sels.Next() {
+		var code, description string
+		if err := sels.Scan(&code, &description); err != nil {
+			return result, err
+		}
+		result = append(result, []string{code, description})
+	}
+	return result, sels.Err()
+}
+
 func GetRemovedCodes(codes []string, game string, removeFromDB bool) ([][]string, error) {
 	result := [][]string{}
 	codesPlaceholder := Placeholders(len(codes))
@@ -108,7 +248,7 @@ func GetRemovedCodes(codes []string, game string, removeFromDB bool) ([][]string
 		queryArgs[i+1] = v
 	}
 
-	q := fmt.Sprintf("SELECT code, description FROM Codes WHERE game = ? AND code NOT IN (%s)", codesPlaceholder)
+	q := fmt.Sprintf("SELECT code, description FROM Codes WHERE game = ? AND removed IS NULL AND source = 'pockettactics' AND code NOT IN (%s)", codesPlaceholder)
 	sels, err := DBScraper.Query(q, queryArgs...)
 	if err != nil {
 		return result, err
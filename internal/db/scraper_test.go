@@ -0,0 +1,51 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muskit/hoyocodes-discord-bot/internal/db"
+)
+
+func TestRestorable(t *testing.T) {
+	removed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		info     db.CodeInfo
+		source   db.CodeSource
+		expected bool
+	}{
+		{
+			name: "active code is not restored",
+			info: db.CodeInfo{},
+			source: db.SourcePocketTactics,
+			expected: false,
+		},
+		{
+			name: "code dropped by source is restored when listed again",
+			info: db.CodeInfo{Removed: removed, RemovedBy: db.RemovedBySource},
+			source: db.SourcePocketTactics,
+			expected: true,
+		},
+		{
+			name: "code confirmed expired stays removed on rescrape",
+			info: db.CodeInfo{Removed: removed, RemovedBy: db.RemovedByModerator},
+			source: db.SourcePocketTactics,
+			expected: false,
+		},
+		{
+			name: "code confirmed expired is restored by an approved report",
+			info: db.CodeInfo{Removed: removed, RemovedBy: db.RemovedByModerator},
+			source: db.SourceCommunity,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.Restorable(tt.info, tt.source); got != tt.expected {
+				t.Errorf("Restorable() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
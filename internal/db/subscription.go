@@ -1,23 +1,120 @@
 package db
 
 import (
+	"database/sql"
+	"time"
+
 	"github.com/hashicorp/go-set/v3"
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+)
+
+// How a subscription's notifications are delivered.
+type DeliveryMode string
+
+const (
+	DeliverChannel DeliveryMode = "channel" // messages in the subscribed channel
+	DeliverForum DeliveryMode = "forum" // one forum post per game, changes as replies
+	DeliverThread DeliveryMode = "thread" // threads under the subscribed channel
+)
+
+// When a new thread (or forum post) is started for a game.
+type ThreadScope string
+
+const (
+	ThreadPerGame ThreadScope = "game"
+	ThreadPerPatch ThreadScope = "patch"
 )
 
+// Where a subscription's notifications end up.
+type DeliveryTarget struct {
+	Mode DeliveryMode
+	ForumID string // only set for DeliverForum
+	ThreadScope ThreadScope
+}
+
+// How a subscription's notifications are laid out.
+type NotificationFormat string
+
+const (
+	FormatText NotificationFormat = "text"
+	FormatEmbed NotificationFormat = "embed"
+)
+
+// How often changes are batched into a digest.
+type DigestFrequency string
+
+const (
+	DigestOff DigestFrequency = "off" // announce each change
+	DigestDaily DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+// When a subscription's digests are sent.
+type Digest struct {
+	Frequency DigestFrequency
+	Minute int // of the day, in Timezone
+	Weekday time.Weekday // for weekly digests
+	Timezone string // IANA name, eg. Europe/Berlin
+	Last time.Time // when the last digest was due; zero if none was yet
+}
+
 type Subscription struct {
 	ChannelID string
+	GuildID string
 	Active bool
 	AnnounceAdds bool
 	AnnounceRems bool
+	Target DeliveryTarget
+	Format NotificationFormat
+	Digest Digest
+}
+
+const subscriptionCols = "Subscriptions.channel_id, guild_id, active, announce_additions, announce_removals, delivery_mode, target_id, thread_scope, format, digest, digest_minute, digest_weekday, digest_timezone, digest_last"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscription(row rowScanner) (Subscription, error) {
+	var sub Subscription
+	var forumID sql.NullString
+	var digestLast sql.NullTime
+	err := row.Scan(&sub.ChannelID, &sub.GuildID, &sub.Active, &sub.AnnounceAdds, &sub.AnnounceRems, &sub.Target.Mode, &forumID, &sub.Target.ThreadScope, &sub.Format,
+		&sub.Digest.Frequency, &sub.Digest.Minute, &sub.Digest.Weekday, &sub.Digest.Timezone, &digestLast)
+	sub.Target.ForumID = forumID.String
+	sub.Digest.Last = digestLast.Time
+	return sub, err
+}
+
+func scanSubscriptions(rows *sql.Rows) ([]Subscription, error) {
+	result := []Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, sub)
+	}
+	return result, rows.Err()
 }
 
-func CreateSubscription(channelID string, guildID string, additions bool, removals bool) error {
-	_, err := DBCfg.Exec("INSERT INTO Subscriptions SET channel_id = ?, guild_id = ?, announce_additions = ?, announce_removals = ?", channelID, guildID, additions, removals)
+// NULL target_id for non-forum deliveries
+func targetArg(target DeliveryTarget) any {
+	if target.Mode != DeliverForum || target.ForumID == "" {
+		return nil
+	}
+	return target.ForumID
+}
+
+func CreateSubscription(channelID string, guildID string, additions bool, removals bool, target DeliveryTarget, format NotificationFormat) error {
+	_, err := DBCfg.Exec("INSERT INTO Subscriptions SET channel_id = ?, guild_id = ?, announce_additions = ?, announce_removals = ?, delivery_mode = ?, target_id = ?, thread_scope = ?, format = ?",
+		channelID, guildID, additions, removals, target.Mode, targetArg(target), target.ThreadScope, format)
 	return err
 }
 
-func UpdateSubscription(channelID string, additions bool, removals bool) error {
-	_, err := DBCfg.Exec("UPDATE Subscriptions SET announce_additions = ?, announce_removals = ?, active = true WHERE channel_id = ?", additions, removals, channelID)
+func UpdateSubscription(channelID string, additions bool, removals bool, target DeliveryTarget, format NotificationFormat) error {
+	_, err := DBCfg.Exec("UPDATE Subscriptions SET announce_additions = ?, announce_removals = ?, delivery_mode = ?, target_id = ?, thread_scope = ?, format = ?, active = true WHERE channel_id = ?",
+		additions, removals, target.Mode, targetArg(target), target.ThreadScope, format, channelID)
 	return err
 }
 
@@ -32,85 +129,65 @@ func DeleteSubscription(channelID string) error {
 	return err
 }
 
+// Delete every subscription of a server, eg. after the bot is removed from it.
+func DeleteGuildSubscriptions(guildID string) error {
+	_, err := DBCfg.Exec("DELETE FROM Subscriptions WHERE guild_id = ?", guildID)
+	return err
+}
+
+// Fall back to posting in the subscribed channel for subscriptions
+// delivering to a forum that's gone.
+func ResetForumSubscriptions(forumID string) error {
+	if _, err := DBCfg.Exec("DELETE SubscriptionThreads FROM SubscriptionThreads JOIN Subscriptions USING (channel_id) WHERE target_id = ?", forumID); err != nil {
+		return err
+	}
+	_, err := DBCfg.Exec("UPDATE Subscriptions SET delivery_mode = 'channel', target_id = NULL WHERE delivery_mode = 'forum' AND target_id = ?", forumID)
+	return err
+}
+
 func GetSubscription(channelID string) (*Subscription, error) {
-	var announceAdds bool
-	var announceRems bool
-	var active bool
-	s := DBCfg.QueryRow("SELECT announce_additions, announce_removals, active FROM Subscriptions WHERE channel_id = ?", channelID)
-	if err := s.Scan(&announceAdds, &announceRems, &active); err != nil {
+	s := DBCfg.QueryRow("SELECT "+subscriptionCols+" FROM Subscriptions WHERE channel_id = ?", channelID)
+	sub, err := scanSubscription(s)
+	if err != nil {
 		return nil, err
 	}
-
-	return &Subscription{
-		ChannelID: channelID,
-		Active: active,
-		AnnounceAdds: announceAdds,
-		AnnounceRems: announceRems,
-	}, nil
+	return &sub, nil
 }
 
-func GetGuildSubscriptions(guildID string) ([]Subscription, error) {
-	result := []Subscription{}
-
-	sels, err := DBCfg.Query("SELECT channel_id, active, announce_additions, announce_removals FROM Subscriptions WHERE guild_id = ?", guildID)
+// All active subscriptions.
+func GetSubscriptions() ([]Subscription, error) {
+	sels, err := DBCfg.Query("SELECT " + subscriptionCols + " FROM Subscriptions WHERE active = TRUE")
 	if err != nil {
-		return result, err
+		return []Subscription{}, err
 	}
+	return scanSubscriptions(sels)
+}
 
-	var channel_id string
-	var active bool
-	var announceAdds bool
-	var announceRems bool
-	for sels.Next() {
-		sels.Scan(&channel_id, &active, &announceAdds, &announceRems)
-		result = append(result, Subscription{
-			ChannelID: channel_id,
-			Active: active,
-			AnnounceAdds: announceAdds,
-			AnnounceRems: announceRems,
-		})
-	}
-	err = sels.Err()
+func GetGuildSubscriptions(guildID string) ([]Subscription, error) {
+	sels, err := DBCfg.Query("SELECT "+subscriptionCols+" FROM Subscriptions WHERE guild_id = ?", guildID)
 	if err != nil {
-		return result, err
+		return []Subscription{}, err
 	}
-
-	return result, nil
+	return scanSubscriptions(sels)
 }
 
 func GetGameSubscriptions(game string) ([]Subscription, error) {
-	result := []Subscription{}
-
 	filteredQ := `
-	SELECT Subscriptions.channel_id, active, announce_additions, announce_removals FROM Subscriptions
+	SELECT ` + subscriptionCols + ` FROM Subscriptions
 	JOIN SubscriptionGames ON SubscriptionGames.channel_id=Subscriptions.channel_id
 	WHERE SubscriptionGames.game = ? AND active = TRUE;
 	`
 	sels, err := DBCfg.Query(filteredQ, game)
 	if err != nil {
-		return result, err
+		return []Subscription{}, err
 	}
-
-	for sels.Next() {
-		var channel_id string
-		var active bool
-		var announceAdds bool
-		var announceRems bool
-
-		sels.Scan(&channel_id, &active, &announceAdds, &announceRems)
-		result = append(result, Subscription{
-			ChannelID: channel_id,
-			Active: active,
-			AnnounceAdds: announceAdds,
-			AnnounceRems: announceRems,
-		})
-	}
-	if sels.Err() != nil {
-		return result, sels.Err()
+	result, err := scanSubscriptions(sels)
+	if err != nil {
+		return result, err
 	}
 
 	nofilterQ := `
-	SELECT Subscriptions.channel_id, active, announce_additions, announce_removals FROM Subscriptions
+	SELECT ` + subscriptionCols + ` FROM Subscriptions
 	LEFT JOIN SubscriptionGames ON SubscriptionGames.channel_id = Subscriptions.channel_id
 	WHERE game IS NULL AND Subscriptions.active = TRUE;
 	`
@@ -118,40 +195,117 @@ func GetGameSubscriptions(game string) ([]Subscription, error) {
 	if err != nil {
 		return result, err
 	}
+	unfiltered, err := scanSubscriptions(sels)
+	result = append(result, unfiltered...)
+	if err != nil {
+		return result, err
+	}
 
-	for sels.Next() {
-		var channel_id string
-		var active bool
-		var announceAdds bool
-		var announceRems bool
+	return result, nil
+}
 
-		sels.Scan(&channel_id, &active, &announceAdds, &announceRems)
-		result = append(result, Subscription{
-			ChannelID: channel_id,
-			Active: active,
-			AnnounceAdds: announceAdds,
-			AnnounceRems: announceRems,
-		})
+// Returns the thread or forum post used for a subscription's game and scope.
+func GetSubscriptionThread(channelID string, game string, scopeKey string) (string, error) {
+	var threadID string
+	row := DBCfg.QueryRow("SELECT thread_id FROM SubscriptionThreads WHERE channel_id = ? AND game = ? AND scope_key = ?", channelID, game, scopeKey)
+	err := row.Scan(&threadID)
+	return threadID, err
+}
+
+func SetSubscriptionThread(channelID string, game string, scopeKey string, threadID string) error {
+	_, err := DBCfg.Exec("INSERT INTO SubscriptionThreads SET channel_id = ?, game = ?, scope_key = ?, thread_id = ? ON DUPLICATE KEY UPDATE thread_id = ?", channelID, game, scopeKey, threadID, threadID)
+	return err
+}
+
+// Forget all threads of a subscription, eg. when its delivery target changes.
+func ClearSubscriptionThreads(channelID string) error {
+	_, err := DBCfg.Exec("DELETE FROM SubscriptionThreads WHERE channel_id = ?", channelID)
+	return err
+}
+
+// Forget a deleted thread or forum post; a new one is started on the next delivery.
+func ForgetSubscriptionThread(threadID string) error {
+	_, err := DBCfg.Exec("DELETE FROM SubscriptionThreads WHERE thread_id = ?", threadID)
+	return err
+}
+
+type PingRole struct {
+	RoleID string
+	Game string // empty pings for all games
+}
+
+// An empty game pings the role for all games.
+func AddPingRole(channelID string, pingRole string, game string) error {
+	_, err := DBCfg.Exec("INSERT INTO SubscriptionPingRoles SET channel_id = ?, role_id = ?, game = ?", channelID, pingRole, game)
+	return err
+}
+
+// An empty game removes the role for every game it was added for. Returns
+// whether anything was removed; a role pinging for all games isn't removed
+// for a single game (see ExcludePingRoleGame).
+func RemovePingRole(channelID string, pingRole string, game string) (bool, error) {
+	var res sql.Result
+	var err error
+	if game == "" {
+		res, err = DBCfg.Exec("DELETE FROM SubscriptionPingRoles WHERE channel_id = ? AND role_id = ?", channelID, pingRole)
+	} else {
+		res, err = DBCfg.Exec("DELETE FROM SubscriptionPingRoles WHERE channel_id = ? AND role_id = ? AND game = ?", channelID, pingRole, game)
 	}
-	if sels.Err() != nil {
-		return result, sels.Err()
+	if err != nil {
+		return false, err
 	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
 
-	return result, nil
+// Make a role pinging for all games ping for every game but game instead.
+// Returns whether the role was pinging for all games.
+func ExcludePingRoleGame(channelID string, pingRole string, game string) (bool, error) {
+	var count int
+	if err := DBCfg.QueryRow("SELECT COUNT(*) FROM SubscriptionPingRoles WHERE channel_id = ? AND role_id = ? AND game = ''", channelID, pingRole).Scan(&count); err != nil || count == 0 {
+		return false, err
+	}
+	// add the other games before dropping all games, so a failure leaves
+	// the role pinging rather than silent
+	for _, g := range consts.Games {
+		if g == game {
+			continue
+		}
+		if _, err := DBCfg.Exec("INSERT IGNORE INTO SubscriptionPingRoles SET channel_id = ?, role_id = ?, game = ?", channelID, pingRole, g); err != nil {
+			return false, err
+		}
+	}
+	return true, RemoveAllGamesPingRole(channelID, pingRole)
 }
 
-func AddPingRole(channelID string, pingRole string) error {
-	_, err := DBCfg.Exec("INSERT INTO SubscriptionPingRoles SET channel_id = ?, role_id = ?", channelID, pingRole)
+// Stop pinging a role for all games, keeping any game-specific pings.
+func RemoveAllGamesPingRole(channelID string, pingRole string) error {
+	_, err := DBCfg.Exec("DELETE FROM SubscriptionPingRoles WHERE channel_id = ? AND role_id = ? AND game = ''", channelID, pingRole)
 	return err
 }
 
-func RemovePingRole(channelID string, pingRole string) error {
-	_, err := DBCfg.Exec("DELETE FROM SubscriptionPingRoles WHERE channel_id = ? AND role_id = ?", channelID, pingRole)
-	return err
+func GetPingRoles(channelID string) ([]PingRole, error) {
+	rows, err := DBCfg.Query("SELECT role_id, game FROM SubscriptionPingRoles WHERE channel_id = ? ORDER BY game", channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []PingRole{}
+	for rows.Next() {
+		var val PingRole
+		rows.Scan(&val.RoleID, &val.Game)
+		results = append(results, val)
+	}
+	if rows.Err() != nil {
+		return results, rows.Err()
+	}
+
+	return results, nil
 }
 
-func GetPingRoles(channelID string) ([]string, error) {
-	rows, err := DBCfg.Query("SELECT role_id FROM SubscriptionPingRoles WHERE channel_id = ?", channelID)
+// Returns IDs of roles to ping for a game's changes, including roles without a game.
+func GetGamePingRoles(channelID string, game string) ([]string, error) {
+	rows, err := DBCfg.Query("SELECT DISTINCT role_id FROM SubscriptionPingRoles WHERE channel_id = ? AND (game = '' OR game = ?)", channelID, game)
 	if err != nil {
 		return nil, err
 	}
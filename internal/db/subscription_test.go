@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// A row holding values as the driver returns them.
+type fakeRow []any
+
+func (r fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("expected %d columns, got %d", len(r), len(dest))
+	}
+	for i, d := range dest {
+		if scanner, ok := d.(sql.Scanner); ok {
+			if err := scanner.Scan(r[i]); err != nil {
+				return fmt.Errorf("column %d: %w", i, err)
+			}
+			continue
+		}
+		target := reflect.ValueOf(d).Elem()
+		target.Set(reflect.ValueOf(r[i]).Convert(target.Type()))
+	}
+	return nil
+}
+
+func TestConnStrsParseTime(t *testing.T) {
+	for _, connStr := range []string{connStrCfg, connStrScraper} {
+		cfg, err := mysql.ParseDSN(fmt.Sprintf(connStr, "user", "pass", "127.0.0.1", "3306"))
+		if err != nil {
+			t.Fatalf("ParseDSN(%q) failed: %v", connStr, err)
+		}
+		if !cfg.ParseTime {
+			t.Errorf("%q doesn't set parseTime; DATETIME columns would scan as []byte", connStr)
+		}
+	}
+}
+
+func TestScanSubscriptionDigestLast(t *testing.T) {
+	last := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	row := fakeRow{"123", "456", true, true, false, "channel", nil, "game", "text", "daily", int64(540), int64(1), "UTC", last}
+
+	sub, err := scanSubscription(row)
+	if err != nil {
+		t.Fatalf("scanSubscription() failed: %v", err)
+	}
+	if !sub.Digest.Last.Equal(last) {
+		t.Errorf("Digest.Last = %v, expected %v", sub.Digest.Last, last)
+	}
+}
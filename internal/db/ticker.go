@@ -1,66 +1,165 @@
 package db
 
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
+)
+
+// How a ticker lays out its codes.
+type TickerStyle string
+
+const (
+	StyleEmbed TickerStyle = "embed"
+	StyleText TickerStyle = "text"
+	StyleTable TickerStyle = "table"
+)
+
+// Outcome of a ticker's last update.
+type TickerStatus string
+
+const (
+	TickerOK TickerStatus = "ok"
+	TickerMissing TickerStatus = "missing" // message was deleted
+	TickerForbidden TickerStatus = "forbidden" // no access to edit
+)
+
 type Ticker struct {
 	MessageID string
-	Game string
+	Games []string // empty shows all games
+	Style TickerStyle
+	ContentHash string // of the last rendered content
+	Status TickerStatus
+	Failures int // updates failed in a row
 	GuildID string
 	ChannelID string
 }
 
-func AddTicker(messageID string, game string, channelID string, guildID string) error {
-	_, err := DBCfg.Exec("INSERT INTO Tickers SET message_id = ?, game = ?, channel_id = ?, guild_id = ?", messageID, game, channelID, guildID)
-	return err
+// Games the ticker displays, in display order.
+func (t Ticker) ShownGames() []string {
+	if len(t.Games) == 0 {
+		return consts.Games
+	}
+	return t.Games
 }
 
-func RemoveTicker(messageID string) error {
-	_, err := DBCfg.Exec("DELETE FROM Tickers WHERE message_id = ?", messageID)
-	return err
+const tickerSelect = `
+SELECT Tickers.message_id, channel_id, guild_id, style, content_hash, status, failures, GROUP_CONCAT(TickerGames.game ORDER BY TickerGames.game) FROM Tickers
+LEFT JOIN TickerGames ON TickerGames.message_id = Tickers.message_id
+`
+
+func scanTickers(sels *sql.Rows) ([]Ticker, error) {
+	ret := []Ticker{}
+	for sels.Next() {
+		t := Ticker{}
+		var hash, games sql.NullString
+		sels.Scan(&t.MessageID, &t.ChannelID, &t.GuildID, &t.Style, &hash, &t.Status, &t.Failures, &games)
+		t.ContentHash = hash.String
+		if games.Valid {
+			t.Games = strings.Split(games.String, ",")
+		}
+		ret = append(ret, t)
+	}
+	return ret, sels.Err()
 }
 
-// returns a slice of channelID,messageID pairs
-func GetGameTickers(game string) ( [][]string, error ) {
-	ret := [][]string{}
-	sels, err := DBCfg.Query("SELECT channel_id, message_id FROM Tickers WHERE game = ?", game)
+// An empty games slice makes the ticker show all games.
+func AddTicker(messageID string, games []string, style TickerStyle, channelID string, guildID string) error {
+	_, err := DBCfg.Exec("INSERT INTO Tickers SET message_id = ?, channel_id = ?, guild_id = ?, style = ?", messageID, channelID, guildID, style)
 	if err != nil {
-		return ret, err
+		return err
 	}
+	return SetTickerGames(messageID, games)
+}
 
-	for sels.Next() {
-		channelID := ""
-		messageID := ""
-		sels.Scan(&channelID, &messageID)
-		ret = append(ret, []string{channelID, messageID})
+func SetTickerGames(messageID string, games []string) error {
+	if _, err := DBCfg.Exec("DELETE FROM TickerGames WHERE message_id = ?", messageID); err != nil {
+		return err
 	}
-	if err = sels.Err(); err != nil {
-		return ret, err
+
+	for _, game := range games {
+		_, err := DBCfg.Exec("INSERT INTO TickerGames SET message_id = ?, game = ?", messageID, game)
+		if err != nil && !IsDuplicateErr(err) {
+			return err
+		}
 	}
+	return nil
+}
 
-	return ret, nil
+func SetTickerStyle(messageID string, style TickerStyle) error {
+	_, err := DBCfg.Exec("UPDATE Tickers SET style = ? WHERE message_id = ?", style, messageID)
+	return err
 }
 
-// returns a slice of channelID,messageID pairs
-func GetGuildTickers(guildID string) ( []Ticker, error ) {
-	ret := []Ticker{}
-	sels, err := DBCfg.Query("SELECT game, channel_id, message_id FROM Tickers WHERE guild_id = ?", guildID)
+// Record a successful update showing content with the given hash.
+func MarkTickerUpdated(messageID string, hash string) error {
+	_, err := DBCfg.Exec("UPDATE Tickers SET content_hash = ?, status = 'ok', failures = 0 WHERE message_id = ?", hash, messageID)
+	return err
+}
+
+// Record a failed update; returns how many updates have failed in a row.
+func MarkTickerFailed(messageID string, status TickerStatus) (int, error) {
+	_, err := DBCfg.Exec("UPDATE Tickers SET status = ?, failures = failures + 1 WHERE message_id = ?", status, messageID)
 	if err != nil {
-		return ret, err
+		return 0, err
 	}
 
-	for sels.Next() {
-		game := ""
-		channelID := ""
-		messageID := ""
-		sels.Scan(&game, &channelID, &messageID)
-		ret = append(ret, Ticker{
-			MessageID: messageID,
-			Game: game,
-			GuildID: guildID,
-			ChannelID: channelID,
-		})
+	var failures int
+	err = DBCfg.QueryRow("SELECT failures FROM Tickers WHERE message_id = ?", messageID).Scan(&failures)
+	return failures, err
+}
+
+// Point a ticker at a new message, eg. after re-posting it.
+func MoveTicker(messageID string, newMessageID string, channelID string) error {
+	_, err := DBCfg.Exec("UPDATE Tickers SET message_id = ?, channel_id = ?, content_hash = NULL, status = 'ok', failures = 0 WHERE message_id = ?", newMessageID, channelID, messageID)
+	return err
+}
+
+func RemoveTicker(messageID string) error {
+	_, err := DBCfg.Exec("DELETE FROM Tickers WHERE message_id = ?", messageID)
+	return err
+}
+
+// Stop tracking the tickers of a deleted channel.
+func RemoveChannelTickers(channelID string) error {
+	_, err := DBCfg.Exec("DELETE FROM Tickers WHERE channel_id = ?", channelID)
+	return err
+}
+
+func RemoveGuildTickers(guildID string) error {
+	_, err := DBCfg.Exec("DELETE FROM Tickers WHERE guild_id = ?", guildID)
+	return err
+}
+
+func GetTickers() ([]Ticker, error) {
+	sels, err := DBCfg.Query(tickerSelect + "GROUP BY Tickers.message_id")
+	if err != nil {
+		return []Ticker{}, err
 	}
-	if err = sels.Err(); err != nil {
-		return ret, err
+	return scanTickers(sels)
+}
+
+// Returns sql.ErrNoRows if the message isn't a ticker.
+func GetTicker(messageID string) (Ticker, error) {
+	sels, err := DBCfg.Query(tickerSelect + "WHERE Tickers.message_id = ? GROUP BY Tickers.message_id", messageID)
+	if err != nil {
+		return Ticker{}, err
 	}
+	tickers, err := scanTickers(sels)
+	if err != nil {
+		return Ticker{}, err
+	}
+	if len(tickers) == 0 {
+		return Ticker{}, sql.ErrNoRows
+	}
+	return tickers[0], nil
+}
 
-	return ret, nil
-}
\ No newline at end of file
+func GetGuildTickers(guildID string) ([]Ticker, error) {
+	sels, err := DBCfg.Query(tickerSelect + "WHERE guild_id = ? GROUP BY Tickers.message_id", guildID)
+	if err != nil {
+		return []Ticker{}, err
+	}
+	return scanTickers(sels)
+}
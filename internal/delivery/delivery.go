@@ -0,0 +1,156 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Backoff before retrying a request that failed on Discord's end.
+const serverErrorBackoff = 2 * time.Second
+
+// A request (or sequence of requests) to send to Discord.
+type Job struct {
+	// Jobs with the same route run one after another, in order. Discord's
+	// rate-limit buckets for messages are per channel, so use the channel ID.
+	Route string
+	// Perform the job, passing opts to every request made. Jobs are retried
+	// from the start on rate limits, so they should resume where they left off.
+	Do func(opts ...discordgo.RequestOption) error
+	// Optionally called with the job's final error; nil if it succeeded.
+	Done func(err error)
+}
+
+// Outcomes of a run's jobs.
+type Stats struct {
+	Sent int
+	Forbidden int
+	NotFound int
+	Failed int
+	Skipped int // not attempted because the run was cancelled
+	Retried int // retry attempts, across all jobs
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d sent, %d forbidden, %d not found, %d failed, %d skipped, %d retries",
+		s.Sent, s.Forbidden, s.NotFound, s.Failed, s.Skipped, s.Retried)
+}
+
+// HTTP status of a failed Discord request; 0 if it isn't a REST error.
+func StatusCode(err error) int {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		return restErr.Response.StatusCode
+	}
+	return 0
+}
+
+// Discord's JSON error code of a failed request, eg. discordgo.ErrCodeUnknownMessage;
+// 0 if there is none.
+func ErrorCode(err error) int {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Message != nil {
+		return restErr.Message.Code
+	}
+	return 0
+}
+
+// Run jobs with up to concurrency routes in flight at once, retrying rate
+// limited and server-side failures up to maxRetries times each. Cancelling
+// ctx stops the run; jobs not yet attempted are skipped.
+func Run(ctx context.Context, concurrency int, maxRetries int, jobs []Job) Stats {
+	// group by route, keeping order
+	routes := [][]Job{}
+	routeIdx := map[string]int{}
+	for _, job := range jobs {
+		idx, exists := routeIdx[job.Route]
+		if !exists {
+			idx = len(routes)
+			routeIdx[job.Route] = idx
+			routes = append(routes, []Job{})
+		}
+		routes[idx] = append(routes[idx], job)
+	}
+
+	stats := Stats{}
+	statsMutex := sync.Mutex{}
+	record := func(f func(*Stats)) {
+		statsMutex.Lock()
+		f(&stats)
+		statsMutex.Unlock()
+	}
+
+	queue := make(chan []Job)
+	wg := sync.WaitGroup{}
+	for w := 0; w < max(concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for route := range queue {
+				for _, job := range route {
+					if ctx.Err() != nil {
+						record(func(s *Stats) { s.Skipped++ })
+						continue
+					}
+					runJob(ctx, maxRetries, job, record)
+				}
+			}
+		}()
+	}
+
+	for _, route := range routes {
+		queue <- route
+	}
+	close(queue)
+	wg.Wait()
+
+	return stats
+}
+
+func runJob(ctx context.Context, maxRetries int, job Job, record func(func(*Stats))) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = job.Do(discordgo.WithContext(ctx), discordgo.WithRetryOnRatelimit(false))
+		if err == nil || attempt >= maxRetries || ctx.Err() != nil {
+			break
+		}
+
+		// wait out rate limits and server hiccups, then try again
+		var wait time.Duration
+		var rlErr *discordgo.RateLimitError
+		if errors.As(err, &rlErr) {
+			wait = rlErr.RetryAfter
+		} else if StatusCode(err) >= http.StatusInternalServerError {
+			wait = serverErrorBackoff * time.Duration(attempt+1)
+		} else {
+			break
+		}
+
+		record(func(s *Stats) { s.Retried++ })
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+
+	record(func(s *Stats) {
+		switch {
+		case err == nil:
+			s.Sent++
+		case StatusCode(err) == http.StatusForbidden:
+			s.Forbidden++
+		case StatusCode(err) == http.StatusNotFound:
+			s.NotFound++
+		default:
+			s.Failed++
+		}
+	})
+	if job.Done != nil {
+		job.Done(err)
+	}
+}
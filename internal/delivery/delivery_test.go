@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func restErr(status int) error {
+	return &discordgo.RESTError{Response: &http.Response{StatusCode: status, Status: http.StatusText(status)}}
+}
+
+func TestRunStats(t *testing.T) {
+	rateLimited := false
+	jobs := []Job{
+		{Route: "a", Do: func(opts ...discordgo.RequestOption) error { return nil }},
+		{Route: "a", Do: func(opts ...discordgo.RequestOption) error { return restErr(http.StatusForbidden) }},
+		{Route: "b", Do: func(opts ...discordgo.RequestOption) error { return restErr(http.StatusNotFound) }},
+		{Route: "c", Do: func(opts ...discordgo.RequestOption) error {
+			if !rateLimited {
+				rateLimited = true
+				return &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{
+					TooManyRequests: &discordgo.TooManyRequests{RetryAfter: time.Millisecond},
+				}}
+			}
+			return nil
+		}},
+		{Route: "d", Do: func(opts ...discordgo.RequestOption) error { return restErr(http.StatusBadRequest) }},
+	}
+
+	stats := Run(context.Background(), 2, 3, jobs)
+	expected := Stats{Sent: 2, Forbidden: 1, NotFound: 1, Failed: 1, Retried: 1}
+	if stats != expected {
+		t.Errorf("expected %v, got %v", expected, stats)
+	}
+}
+
+func TestRunRouteOrder(t *testing.T) {
+	order := []int{}
+	mutex := sync.Mutex{}
+	jobs := []Job{}
+	for i := 0; i < 5; i++ {
+		jobs = append(jobs, Job{Route: "same", Do: func(opts ...discordgo.RequestOption) error {
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			return nil
+		}})
+	}
+
+	Run(context.Background(), 4, 0, jobs)
+	for i, v := range order {
+		if i != v {
+			t.Fatalf("expected jobs of a route to run in order, got %v", order)
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := 0
+	jobs := []Job{
+		{Route: "a", Do: func(opts ...discordgo.RequestOption) error { return nil }, Done: func(err error) { done++ }},
+		{Route: "b", Do: func(opts ...discordgo.RequestOption) error { return nil }, Done: func(err error) { done++ }},
+	}
+
+	stats := Run(ctx, 1, 3, jobs)
+	if stats.Skipped != 2 || done != 0 {
+		t.Errorf("expected all jobs skipped, got %v (%d done)", stats, done)
+	}
+}
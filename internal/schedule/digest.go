@@ -0,0 +1,28 @@
+package schedule
+
+import "time"
+
+// The latest time at or before now a digest is due: daily at the given
+// minute of the day in loc, and on the given weekday if weekly.
+func LastDigest(weekly bool, weekday time.Weekday, minute int, loc *time.Location, now time.Time) time.Time {
+	local := now.In(loc)
+	due := time.Date(local.Year(), local.Month(), local.Day(), minute/60, minute%60, 0, 0, loc)
+	days := 1
+	if weekly {
+		days = 7
+		due = due.AddDate(0, 0, -((int(local.Weekday()) - int(weekday) + 7) % 7))
+	}
+	if due.After(now) {
+		due = due.AddDate(0, 0, -days)
+	}
+	return due
+}
+
+// The first time after now a digest is due; see LastDigest.
+func NextDigest(weekly bool, weekday time.Weekday, minute int, loc *time.Location, now time.Time) time.Time {
+	last := LastDigest(weekly, weekday, minute, loc, now)
+	if weekly {
+		return last.AddDate(0, 0, 7)
+	}
+	return last.AddDate(0, 0, 1)
+}
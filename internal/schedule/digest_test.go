@@ -0,0 +1,52 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestLastDigest(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wednesday 2026-10-21, 08:30 in Berlin (UTC+2)
+	now := time.Date(2026, 10, 21, 6, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		weekly bool
+		weekday time.Weekday
+		minute int
+		expected time.Time
+	}{
+		{"daily, later today", false, 0, 9 * 60, time.Date(2026, 10, 20, 9, 0, 0, 0, berlin)},
+		{"daily, earlier today", false, 0, 8 * 60, time.Date(2026, 10, 21, 8, 0, 0, 0, berlin)},
+		{"weekly, earlier this week", true, time.Monday, 9 * 60, time.Date(2026, 10, 19, 9, 0, 0, 0, berlin)},
+		{"weekly, today but later", true, time.Wednesday, 9 * 60, time.Date(2026, 10, 14, 9, 0, 0, 0, berlin)},
+		{"weekly, today and earlier", true, time.Wednesday, 8 * 60, time.Date(2026, 10, 21, 8, 0, 0, 0, berlin)},
+	}
+	for _, test := range tests {
+		result := LastDigest(test.weekly, test.weekday, test.minute, berlin, now)
+		if !result.Equal(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestNextDigestDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// clocks go back on 2026-10-25; digests stay at 09:00 local
+	now := time.Date(2026, 10, 24, 12, 0, 0, 0, berlin)
+	expected := time.Date(2026, 10, 25, 9, 0, 0, 0, berlin)
+	if result := NextDigest(false, 0, 9*60, berlin, now); !result.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+	if result := NextDigest(false, 0, 9*60, berlin, now); result.Sub(now) != 22*time.Hour {
+		t.Errorf("expected the next digest in 22h, got %v", result.Sub(now))
+	}
+}
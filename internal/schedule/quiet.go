@@ -0,0 +1,32 @@
+package schedule
+
+import "time"
+
+// Minutes of the day from the local midnight before t.
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+// Whether now falls in quiet hours from start to end, in minutes of the day
+// in loc. Hours wrap past midnight if end is before start; equal start and
+// end mean no quiet hours.
+func InQuietHours(start int, end int, loc *time.Location, now time.Time) bool {
+	minute := minuteOfDay(now.In(loc))
+	if start <= end {
+		return start <= minute && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// When quiet hours containing now end; now if it's outside them.
+func QuietHoursEnd(start int, end int, loc *time.Location, now time.Time) time.Time {
+	if !InQuietHours(start, end, loc, now) {
+		return now
+	}
+	local := now.In(loc)
+	ends := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !ends.After(now) {
+		ends = ends.AddDate(0, 0, 1)
+	}
+	return ends
+}
@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name string
+		start, end int
+		now time.Time
+		quiet bool
+		ends time.Time
+	}{
+		{"overnight, after start", 23 * 60, 7 * 60, time.Date(2026, 10, 20, 23, 30, 0, 0, tokyo), true, time.Date(2026, 10, 21, 7, 0, 0, 0, tokyo)},
+		{"overnight, before end", 23 * 60, 7 * 60, time.Date(2026, 10, 21, 3, 0, 0, 0, tokyo), true, time.Date(2026, 10, 21, 7, 0, 0, 0, tokyo)},
+		{"overnight, at end", 23 * 60, 7 * 60, time.Date(2026, 10, 21, 7, 0, 0, 0, tokyo), false, time.Time{}},
+		{"overnight, daytime", 23 * 60, 7 * 60, time.Date(2026, 10, 21, 12, 0, 0, 0, tokyo), false, time.Time{}},
+		{"same day", 13 * 60, 14 * 60, time.Date(2026, 10, 21, 13, 15, 0, 0, tokyo), true, time.Date(2026, 10, 21, 14, 0, 0, 0, tokyo)},
+		{"none", 8 * 60, 8 * 60, time.Date(2026, 10, 21, 8, 0, 0, 0, tokyo), false, time.Time{}},
+	}
+	for _, test := range tests {
+		// given in UTC, judged in the guild's zone
+		now := test.now.UTC()
+		if quiet := InQuietHours(test.start, test.end, tokyo, now); quiet != test.quiet {
+			t.Errorf("%v: expected quiet %v, got %v", test.name, test.quiet, quiet)
+		}
+		expected := test.ends
+		if !test.quiet {
+			expected = now
+		}
+		if ends := QuietHoursEnd(test.start, test.end, tokyo, now); !ends.Equal(expected) {
+			t.Errorf("%v: expected quiet hours to end %v, got %v", test.name, expected, ends)
+		}
+	}
+}
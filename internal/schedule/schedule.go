@@ -0,0 +1,194 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// When a game is expected to stream, and so to release codes.
+type Window struct {
+	Game string `json:"game"`
+	Title string `json:"title,omitempty"`
+	Start time.Time `json:"start"`
+	End time.Time `json:"end"`
+}
+
+// How often to scrape a game.
+type Policy struct {
+	Default time.Duration // to start with
+	Min time.Duration // right after a change
+	Max time.Duration // after backing off on unchanged pages
+	Livestream time.Duration // during a livestream window
+	// How long to keep polling fast after a window ends; codes usually
+	// show up on the source some time after the stream.
+	LivestreamTail time.Duration
+}
+
+type gameState struct {
+	interval time.Duration
+	next time.Time
+}
+
+// Per-game scrape times, safe for concurrent use.
+type Scheduler struct {
+	mutex sync.Mutex
+	policy Policy
+	windows []Window
+	games map[string]*gameState
+	rescheduled chan struct{}
+}
+
+// A scheduler with every game due at now.
+func New(policy Policy, games []string, windows []Window, now time.Time) *Scheduler {
+	s := &Scheduler{policy: policy, windows: windows, games: map[string]*gameState{}, rescheduled: make(chan struct{}, 1)}
+	for _, game := range games {
+		s.games[game] = &gameState{interval: policy.Default, next: now}
+	}
+	return s
+}
+
+// Read livestream windows from a JSON file of [{"game", "title", "start", "end"}],
+// with RFC 3339 times; titles are optional.
+func LoadCalendar(path string) ([]Window, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	windows := []Window{}
+	if err = json.Unmarshal(data, &windows); err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		if !w.End.After(w.Start) {
+			return nil, fmt.Errorf("livestream of %v starting %v ends before it starts", w.Game, w.Start.Format(time.RFC3339))
+		}
+	}
+	return windows, nil
+}
+
+// Replace the livestream windows. Games due later than a window they're
+// now in, or one starting sooner, are brought forward.
+func (s *Scheduler) SetWindows(windows []Window, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.windows = windows
+
+	moved := false
+	for game, state := range s.games {
+		next := state.next
+		if fast := now.Add(s.policy.Livestream); s.inLivestream(game, now) && fast.Before(next) {
+			next = fast
+		}
+		for _, w := range windows {
+			if w.Game == game && w.Start.After(now) && w.Start.Before(next) {
+				next = w.Start
+			}
+		}
+		if next.Before(state.next) {
+			state.next = next
+			moved = true
+		}
+	}
+	if moved {
+		select {
+		case s.rescheduled <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Receives when SetWindows brings a game's next scrape forward, so anyone
+// sleeping until NextRun should check it again.
+func (s *Scheduler) Rescheduled() <-chan struct{} {
+	return s.rescheduled
+}
+
+// Whether a game is in a livestream window, including its tail.
+func (s *Scheduler) InLivestream(game string, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.inLivestream(game, now)
+}
+
+func (s *Scheduler) inLivestream(game string, now time.Time) bool {
+	for _, w := range s.windows {
+		if w.Game == game && !now.Before(w.Start) && now.Before(w.End.Add(s.policy.LivestreamTail)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Games due to be scraped at now, sorted by name.
+func (s *Scheduler) Due(now time.Time) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	due := []string{}
+	for game, state := range s.games {
+		if !state.next.After(now) {
+			due = append(due, game)
+		}
+	}
+	slices.Sort(due)
+	return due
+}
+
+// When a game is next scraped; zero if it isn't scheduled.
+func (s *Scheduler) Next(game string) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if state, exists := s.games[game]; exists {
+		return state.next
+	}
+	return time.Time{}
+}
+
+// The earliest next scrape of any game.
+func (s *Scheduler) NextRun() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	next := time.Time{}
+	for _, state := range s.games {
+		if next.IsZero() || state.next.Before(next) {
+			next = state.next
+		}
+	}
+	return next
+}
+
+// Record that a game was scraped at now, and whether anything changed;
+// returns when it's next due. Changes shorten the interval to the minimum,
+// unchanged pages double it up to the maximum. Livestream windows poll at
+// their own rate without touching the interval.
+func (s *Scheduler) Done(game string, changed bool, now time.Time) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state, exists := s.games[game]
+	if !exists {
+		state = &gameState{interval: s.policy.Default}
+		s.games[game] = state
+	}
+
+	if changed {
+		state.interval = s.policy.Min
+	} else {
+		state.interval = min(state.interval*2, s.policy.Max)
+	}
+
+	next := now.Add(state.interval)
+	if s.inLivestream(game, now) {
+		next = now.Add(min(state.interval, s.policy.Livestream))
+	}
+	// don't sleep through the start of a stream
+	for _, w := range s.windows {
+		if w.Game == game && w.Start.After(now) && w.Start.Before(next) {
+			next = w.Start
+		}
+	}
+	state.next = next
+	return next
+}
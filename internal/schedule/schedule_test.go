@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var policy = Policy{
+	Default: 2 * time.Hour,
+	Min: 15 * time.Minute,
+	Max: 4 * time.Hour,
+	Livestream: 5 * time.Minute,
+	LivestreamTail: 3 * time.Hour,
+}
+
+var start = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestBackoff(t *testing.T) {
+	s := New(policy, []string{"a", "b"}, nil, start)
+	if due := s.Due(start); !slices.Equal(due, []string{"a", "b"}) {
+		t.Fatalf("expected all games due at start, got %v", due)
+	}
+
+	tests := []struct {
+		changed bool
+		expected time.Duration
+	}{
+		{false, 4 * time.Hour}, // doubled from default
+		{false, 4 * time.Hour}, // capped
+		{true, 15 * time.Minute},
+		{false, 30 * time.Minute},
+	}
+	now := start
+	for i, test := range tests {
+		next := s.Done("a", test.changed, now)
+		if next.Sub(now) != test.expected {
+			t.Errorf("step %v: expected next in %v, got %v", i, test.expected, next.Sub(now))
+		}
+		now = next
+	}
+
+	if due := s.Due(now.Add(-time.Minute)); !slices.Equal(due, []string{"b"}) {
+		t.Errorf("expected only b due, got %v", due)
+	}
+	if !s.NextRun().Equal(start) {
+		t.Errorf("expected next run at %v, got %v", start, s.NextRun())
+	}
+}
+
+func TestLivestreamWindow(t *testing.T) {
+	window := Window{Game: "a", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour)}
+	s := New(policy, []string{"a", "b"}, []Window{window}, start)
+
+	// wakes up for the start of the stream
+	if next := s.Done("a", false, start); !next.Equal(window.Start) {
+		t.Errorf("expected next at stream start %v, got %v", window.Start, next)
+	}
+	// other games are unaffected
+	if next := s.Done("b", false, start); next.Sub(start) != 4*time.Hour {
+		t.Errorf("expected b next in 4h, got %v", next.Sub(start))
+	}
+
+	// polls fast during the stream and its tail
+	for _, at := range []time.Time{window.Start, window.End, window.End.Add(2 * time.Hour)} {
+		if !s.InLivestream("a", at) {
+			t.Errorf("expected %v to be in the livestream window", at)
+		}
+		if next := s.Done("a", false, at); next.Sub(at) != policy.Livestream {
+			t.Errorf("expected next in %v at %v, got %v", policy.Livestream, at, next.Sub(at))
+		}
+	}
+
+	// and backs off after
+	after := window.End.Add(policy.LivestreamTail)
+	if s.InLivestream("a", after) {
+		t.Errorf("expected %v to be past the livestream window", after)
+	}
+	if next := s.Done("a", false, after); next.Sub(after) != 4*time.Hour {
+		t.Errorf("expected next in 4h after the stream, got %v", next.Sub(after))
+	}
+}
+
+func TestSetWindows(t *testing.T) {
+	s := New(policy, []string{"a", "b"}, nil, start)
+	s.Done("a", false, start)
+	s.Done("b", false, start)
+
+	// a stream announced after the last scrape wakes its game for the start
+	window := Window{Game: "a", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour)}
+	s.SetWindows([]Window{window}, start.Add(time.Minute))
+	if next := s.Next("a"); !next.Equal(window.Start) {
+		t.Errorf("expected a next at stream start %v, got %v", window.Start, next)
+	}
+	if next := s.Next("b"); next.Sub(start) != 4*time.Hour {
+		t.Errorf("expected b next in 4h, got %v", next.Sub(start))
+	}
+	select {
+	case <-s.Rescheduled():
+	default:
+		t.Error("expected a reschedule to be signalled")
+	}
+
+	// nothing moves for windows already accounted for
+	s.SetWindows([]Window{window}, start.Add(2*time.Minute))
+	select {
+	case <-s.Rescheduled():
+		t.Error("expected no reschedule")
+	default:
+	}
+}
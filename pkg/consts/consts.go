@@ -9,6 +9,18 @@ var Games = []string{
 	"Zenless Zone Zero",
 }
 
+// Short names accepted in place of a game's full name, lowercase.
+var GameAliases = map[string]string{
+	"hi3": "Honkai Impact 3rd",
+	"honkai impact": "Honkai Impact 3rd",
+	"gi": "Genshin Impact",
+	"genshin": "Genshin Impact",
+	"hsr": "Honkai Star Rail",
+	"star rail": "Honkai Star Rail",
+	"zzz": "Zenless Zone Zero",
+	"zenless": "Zenless Zone Zero",
+}
+
 var RedeemURL = map[string]string{
 	"Genshin Impact": "https://genshin.hoyoverse.com/en/gift",
 	"Honkai Star Rail": "https://hsr.hoyoverse.com/gift",
@@ -22,9 +34,54 @@ var ArticleURL map[string]string = map[string]string{
 	"Zenless Zone Zero": "https://www.pockettactics.com/zenless-zone-zero/codes",
 }
 
-const UpdateInterval = 2 * time.Hour
+// per-game scrape intervals; see internal/schedule
+const DefaultScrapeInterval = 2 * time.Hour
+const MinScrapeInterval = 15 * time.Minute // right after a change
+const MaxScrapeInterval = 4 * time.Hour // pages unchanged for a while
+const LivestreamScrapeInterval = 5 * time.Minute
+const LivestreamPollTail = 3 * time.Hour // codes reach the source after the stream
+
+// livestream events; roundups of their codes are posted after the poll tail
+const DefaultLivestreamDuration = 2 * time.Hour
+const LivestreamAnnounceLead = time.Hour // countdown posted this long before
+const LivestreamCheckInterval = time.Minute
 const RecentSinceLatestThreshold = 36 * time.Hour
 const RecentThreshold = 7*24*time.Hour
 
+// Discord message limits
+const (
+	MessageContentLimit = 2000
+	MessageEmbedLimit = 10
+	MessageEmbedCharLimit = 6000 // across all embeds of a message
+	EmbedFieldLimit = 25
+	EmbedDescriptionLimit = 4096
+	MessageRowLimit = 5
+	RowButtonLimit = 5
+)
+
+// failed ticker updates in a row before the server owner is told
+const TickerFailureAlertThreshold = 12
+
+// code reports a user can submit per window
+const CodeReportLimit = 3
+const CodeReportWindow = time.Hour
+
+// how long an approved code report stays active if the source never lists it
+const DefaultCommunityCodeLifetime = 7 * 24 * time.Hour
+
+// users reporting a code expired within the window to flag it
+const DefaultExpiryVoteThreshold = 3
+const DefaultExpiryVoteWindow = 24 * time.Hour
+
+// how often due subscription digests are looked for
+const DigestCheckInterval = time.Minute
+
+// Discord delivery fan-out
+const DefaultDeliveryConcurrency = 4
+const DeliveryMaxRetries = 3
+
+// minutes of inactivity before notification threads archive (max allowed)
+const ThreadArchiveDuration = 10080
+
 // guild_id, channel_id, message_id
 const MessageLinkTemplate = "https://discord.com/channels/%v/%v/%v"
\ No newline at end of file
@@ -1,8 +1,14 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
 )
@@ -45,6 +51,179 @@ func CodeRedeemURL(code string, game string) *string {
 	return &url
 }
 
+// A message pointed to by a link. GuildID and ChannelID are empty if only
+// the message ID was given; GuildID is "@me" for DMs.
+type MessageLink struct {
+	GuildID string
+	ChannelID string
+	MessageID string
+}
+
+var messageLinkHosts = map[string]bool{
+	"discord.com": true,
+	"www.discord.com": true,
+	"ptb.discord.com": true,
+	"canary.discord.com": true,
+	"discordapp.com": true,
+	"www.discordapp.com": true,
+	"ptb.discordapp.com": true,
+	"canary.discordapp.com": true,
+}
+
+func isSnowflake(s string) bool {
+	if s == "" || len(s) > 20 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse a Discord message link (from any client) or a raw message ID.
+func ParseMessageLink(link string) (MessageLink, error) {
+	link = strings.Trim(link, " \t\n<>")
+	if isSnowflake(link) {
+		return MessageLink{MessageID: link}, nil
+	}
+
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return MessageLink{}, fmt.Errorf("not a message link: %v", err)
+	}
+	if !messageLinkHosts[strings.ToLower(u.Hostname())] {
+		return MessageLink{}, fmt.Errorf("not a Discord link: %v", u.Hostname())
+	}
+
+	path := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(path) != 4 || path[0] != "channels" {
+		return MessageLink{}, errors.New("not a message link; expected .../channels/<server>/<channel>/<message>")
+	}
+	ret := MessageLink{GuildID: path[1], ChannelID: path[2], MessageID: path[3]}
+	if (!isSnowflake(ret.GuildID) && ret.GuildID != "@me") || !isSnowflake(ret.ChannelID) || !isSnowflake(ret.MessageID) {
+		return MessageLink{}, errors.New("message link has malformed IDs")
+	}
+	return ret, nil
+}
+
+// The game a full name or alias refers to, case-insensitively; empty if none.
+func ResolveGame(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, game := range consts.Games {
+		if strings.ToLower(game) == name {
+			return game
+		}
+	}
+	return consts.GameAliases[name]
+}
+
+// Parse a comma-separated list of games and aliases. games is in
+// consts.Games order without duplicates; unknown holds unrecognized names.
+func ParseGameList(input string) (games []string, unknown []string) {
+	picked := map[string]bool{}
+	for _, name := range strings.Split(input, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		if game := ResolveGame(name); game != "" {
+			picked[game] = true
+		} else {
+			unknown = append(unknown, strings.TrimSpace(name))
+		}
+	}
+
+	games = []string{}
+	for _, game := range consts.Games {
+		if picked[game] {
+			games = append(games, game)
+		}
+	}
+	return games, unknown
+}
+
+// Suggestions for a comma-separated game list being typed: the games picked
+// so far, followed by each remaining game matching what's typed after the
+// last comma.
+func CompleteGameList(input string) []string {
+	done, partial := "", input
+	if idx := strings.LastIndex(input, ","); idx >= 0 {
+		done, partial = input[:idx], input[idx+1:]
+	}
+	picked, _ := ParseGameList(done)
+	partial = strings.ToLower(strings.TrimSpace(partial))
+
+	ret := []string{}
+	if partial == "" && len(picked) > 0 {
+		ret = append(ret, strings.Join(picked, ", "))
+	}
+	for _, game := range consts.Games {
+		if slices.Contains(picked, game) {
+			continue
+		}
+		match := strings.Contains(strings.ToLower(game), partial)
+		for alias, aliased := range consts.GameAliases {
+			match = match || (aliased == game && strings.HasPrefix(alias, partial))
+		}
+		if match {
+			ret = append(ret, strings.Join(append(slices.Clone(picked), game), ", "))
+		}
+	}
+	return ret
+}
+
+// Parse a point in time given as RFC 3339, "2006-01-02 15:04" in UTC,
+// a Unix timestamp, or a Discord timestamp like <t:1729000000:F>.
+func ParseTime(input string) (time.Time, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "<t:") && strings.HasSuffix(input, ">") {
+		input, _, _ = strings.Cut(strings.TrimSuffix(strings.TrimPrefix(input, "<t:"), ">"), ":")
+	}
+	if unix, err := strconv.ParseInt(input, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, input); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02 15:04", input); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q isn't a time; use eg. 2026-10-24T12:00:00+08:00, 2026-10-24 04:00 (UTC) or a Unix timestamp", input)
+}
+
+// Parse a 24-hour time of day like "09:00" into minutes since midnight.
+func ParseClock(input string) (int, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(input))
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a time of day; use 24-hour HH:MM, eg. 09:00 or 18:30", input)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// A minute of the day as 24-hour HH:MM.
+func FormatClock(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+// Human-readable interval, eg. "2 hours" or "90 minutes".
+func FormatInterval(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %v", n, unit)
+		}
+		return fmt.Sprintf("%d %vs", n, unit)
+	}
+
+	if d >= time.Hour && d%time.Hour == 0 {
+		return plural(int(d/time.Hour), "hour")
+	}
+	return plural(int(d.Round(time.Minute)/time.Minute), "minute")
+}
+
 // Return a slice of slices where each slice has a max specified capacity.
 func DownstackIntoSlices[T any](slice []T, cap int) [][]T {
 	slices := [][]T{}
@@ -55,4 +234,71 @@ func DownstackIntoSlices[T any](slice []T, cap int) [][]T {
 		slice = overflow
 	}
 	return append(slices, slice)
-}
\ No newline at end of file
+}
+
+// Split text into chunks of at most limit characters, breaking on line
+// boundaries. Lines longer than limit are broken up mid-line.
+func SplitLines(text string, limit int) []string {
+	chunks := []string{}
+	cur := ""
+	for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+		// break up overlong line
+		for utf8.RuneCountInString(line) > limit {
+			if cur != "" {
+				chunks = append(chunks, cur)
+				cur = ""
+			}
+			runes := []rune(line)
+			chunks = append(chunks, string(runes[:limit]))
+			line = string(runes[limit:])
+		}
+
+		if cur == "" {
+			cur = line
+		} else if utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(line) <= limit {
+			cur += "\n" + line
+		} else {
+			chunks = append(chunks, cur)
+			cur = line
+		}
+	}
+	return append(chunks, cur)
+}
+
+// Split markdown into pages of at most limit characters on line boundaries.
+// Code blocks cut by a page break are closed and reopened on the next page,
+// and each page gets a page indicator when there's more than one.
+func Paginate(text string, limit int) []string {
+	const indicator = "\n-# Page %d/%d"
+	const fence = "```"
+
+	// leave room for the indicator and re-fencing
+	reserve := len(fmt.Sprintf(indicator, 999, 999)) + 2*(len(fence)+1)
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	chunks := SplitLines(text, limit-reserve)
+
+	pages := make([]string, len(chunks))
+	openFence := ""
+	for i, chunk := range chunks {
+		page := chunk
+		if openFence != "" {
+			page = openFence + "\n" + page
+		}
+		for _, line := range strings.Split(chunk, "\n") {
+			if strings.HasPrefix(line, fence) {
+				if openFence == "" {
+					openFence = line
+				} else {
+					openFence = ""
+				}
+			}
+		}
+		if openFence != "" {
+			page += "\n" + fence
+		}
+		pages[i] = page + fmt.Sprintf(indicator, i+1, len(chunks))
+	}
+	return pages
+}
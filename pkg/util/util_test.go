@@ -1,7 +1,12 @@
 package util
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/muskit/hoyocodes-discord-bot/pkg/consts"
 )
 
 func TestCodeListing(t *testing.T) {
@@ -79,3 +84,191 @@ func TestDownstackIntoSlicesNonDivisible(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitLines(t *testing.T) {
+	text := "aaaa\nbbbb\ncc\ndddddddddd"
+	expected := []string{"aaaa", "bbbb\ncc", "ddddddd", "ddd"}
+	result := SplitLines(text, 7)
+	if len(result) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	}
+
+	result = SplitLines("short\ntext", 2000)
+	if len(result) != 1 || result[0] != "short\ntext" {
+		t.Errorf("expected single chunk, got %q", result)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	result := Paginate("fits in one page", 2000)
+	if len(result) != 1 || result[0] != "fits in one page" {
+		t.Errorf("expected single unchanged page, got %q", result)
+	}
+
+	text := "header\n```go\n"
+	for i := 0; i < 30; i++ {
+		text += "line of code\n"
+	}
+	text += "```\nfooter"
+	result = Paginate(text, 200)
+	if len(result) < 2 {
+		t.Fatalf("expected multiple pages, got %q", result)
+	}
+	for i, page := range result {
+		if len(page) > 200 {
+			t.Errorf("page %d is %d characters long", i, len(page))
+		}
+		if strings.Count(page, "```")%2 != 0 {
+			t.Errorf("page %d has an unclosed code block: %q", i, page)
+		}
+	}
+	if !strings.HasPrefix(result[1], "```go\n") {
+		t.Errorf("expected code block to be reopened, got %q", result[1])
+	}
+	if !strings.HasSuffix(result[len(result)-1], fmt.Sprintf("Page %d/%d", len(result), len(result))) {
+		t.Errorf("expected page indicator, got %q", result[len(result)-1])
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	tests := map[time.Duration]string{
+		2 * time.Hour: "2 hours",
+		time.Hour: "1 hour",
+		90 * time.Minute: "90 minutes",
+		time.Minute: "1 minute",
+	}
+	for d, expected := range tests {
+		if result := FormatInterval(d); result != expected {
+			t.Errorf("expected %v, got %v", expected, result)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := map[string]int{
+		"00:00": 0,
+		"09:00": 9 * 60,
+		" 18:30 ": 18*60 + 30,
+		"23:59": 23*60 + 59,
+	}
+	for input, expected := range tests {
+		result, err := ParseClock(input)
+		if err != nil || result != expected {
+			t.Errorf("%q: expected %v, got %v (err: %v)", input, expected, result, err)
+		}
+		if err == nil && FormatClock(result) != strings.TrimSpace(input) {
+			t.Errorf("%q: formatted back as %v", input, FormatClock(result))
+		}
+	}
+
+	for _, input := range []string{"", "24:00", "9am", "12:60"} {
+		if result, err := ParseClock(input); err == nil {
+			t.Errorf("%q: expected error, got %v", input, result)
+		}
+	}
+}
+
+func TestParseMessageLink(t *testing.T) {
+	expected := MessageLink{GuildID: "111", ChannelID: "222", MessageID: "333"}
+	links := []string{
+		"https://discord.com/channels/111/222/333",
+		"https://ptb.discord.com/channels/111/222/333",
+		"https://canary.discord.com/channels/111/222/333",
+		"https://discordapp.com/channels/111/222/333/",
+		"<https://discord.com/channels/111/222/333>",
+		"discord.com/channels/111/222/333",
+	}
+	for _, link := range links {
+		result, err := ParseMessageLink(link)
+		if err != nil || result != expected {
+			t.Errorf("%v: expected %v, got %v (err: %v)", link, expected, result, err)
+		}
+	}
+
+	result, err := ParseMessageLink("333")
+	if err != nil || result != (MessageLink{MessageID: "333"}) {
+		t.Errorf("expected raw message ID, got %v (err: %v)", result, err)
+	}
+
+	result, err = ParseMessageLink("https://discord.com/channels/@me/222/333")
+	if err != nil || result.GuildID != "@me" {
+		t.Errorf("expected DM link, got %v (err: %v)", result, err)
+	}
+
+	bad := []string{
+		"",
+		"https://example.com/channels/111/222/333",
+		"https://discord.com/channels/111/222",
+		"https://discord.com/invite/111/222/333",
+		"https://discord.com/channels/111/abc/333",
+	}
+	for _, link := range bad {
+		if result, err := ParseMessageLink(link); err == nil {
+			t.Errorf("%v: expected error, got %v", link, result)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	expected := time.Date(2026, 10, 24, 4, 0, 0, 0, time.UTC)
+	inputs := []string{
+		"2026-10-24T12:00:00+08:00",
+		"2026-10-24T04:00:00Z",
+		"2026-10-24 04:00",
+		" 1792814400 ",
+		"<t:1792814400:F>",
+		"<t:1792814400>",
+	}
+	for _, input := range inputs {
+		result, err := ParseTime(input)
+		if err != nil || !result.Equal(expected) {
+			t.Errorf("%v: expected %v, got %v (err: %v)", input, expected, result, err)
+		}
+	}
+
+	for _, input := range []string{"", "tomorrow", "2026-10-24", "<t:abc:F>"} {
+		if result, err := ParseTime(input); err == nil {
+			t.Errorf("%v: expected error, got %v", input, result)
+		}
+	}
+}
+
+func TestParseGameList(t *testing.T) {
+	games, unknown := ParseGameList("zzz, Genshin Impact,GI , hsr,")
+	expected := []string{"Genshin Impact", "Honkai Star Rail", "Zenless Zone Zero"}
+	if fmt.Sprint(games) != fmt.Sprint(expected) || len(unknown) != 0 {
+		t.Errorf("expected %v, got %v (unknown: %v)", expected, games, unknown)
+	}
+
+	games, unknown = ParseGameList("hi3, wuwa")
+	if fmt.Sprint(games) != "[Honkai Impact 3rd]" || fmt.Sprint(unknown) != "[wuwa]" {
+		t.Errorf("expected [Honkai Impact 3rd] and unknown [wuwa], got %v and %v", games, unknown)
+	}
+
+	games, unknown = ParseGameList("")
+	if len(games) != 0 || len(unknown) != 0 {
+		t.Errorf("expected nothing, got %v (unknown: %v)", games, unknown)
+	}
+}
+
+func TestCompleteGameList(t *testing.T) {
+	expected := []string{"Honkai Impact 3rd", "Honkai Star Rail"}
+	if result := CompleteGameList("honkai"); fmt.Sprint(result) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	expected = []string{"Genshin Impact, Zenless Zone Zero"}
+	if result := CompleteGameList("gi, zz"); fmt.Sprint(result) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	result := CompleteGameList("hsr, ")
+	if len(result) != len(consts.Games) || result[0] != "Honkai Star Rail" {
+		t.Errorf("expected current pick then one suggestion per other game, got %v", result)
+	}
+}